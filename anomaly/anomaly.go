@@ -0,0 +1,216 @@
+package anomaly
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var log = logging.For("anomaly")
+
+const (
+	NEW_EDGE      = "new_edge"
+	TRAFFIC_SPIKE = "traffic_spike"
+	// SWEEP_INTERVAL is how often idle edges are looked for, in event time.
+	SWEEP_INTERVAL = time.Minute
+)
+
+// Config tunes the detection. During LearningPeriod after the first event
+// of a stack, its edges and rates are learned without raising anything.
+// A window rate is a spike when it exceeds the edge's mean by Sensitivity
+// standard deviations, once the edge has MinSamples windows of history.
+// Edges unseen for MaxIdle are forgotten, and new again when they come back.
+type Config struct {
+	Enabled        bool    `json:"enabled"`
+	LearningPeriod int     `json:"learning_period_ms"`
+	Window         int     `json:"window_ms"`
+	Sensitivity    float64 `json:"sensitivity"`
+	MinSamples     int     `json:"min_samples"`
+	Smoothing      float64 `json:"smoothing"`
+	MaxIdle        int     `json:"max_idle_ms"`
+	Buffer         int     `json:"buffer"`
+}
+
+// edge is the baseline of a connection: an exponentially weighted mean and
+// variance of its bytes per second over the windows it was active in, so
+// that bursty edges are not flagged each time they wake up.
+type edge struct {
+	start   time.Time
+	seen    time.Time
+	bytes   uint64
+	samples int
+	mean    float64
+	vari    float64
+	flagged bool
+}
+
+// baseline holds the edges of a stack between services, so that it
+// survives the redeployments replacing the containers.
+type baseline struct {
+	start time.Time
+	edges map[[2]string]*edge
+}
+
+type Detector struct {
+	config Config
+	mu     sync.Mutex
+	stacks map[string]*baseline
+	swept  time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		LearningPeriod: 24 * 60 * 60 * 1000,
+		Window:         10000,
+		Sensitivity:    4,
+		MinSamples:     6,
+		Smoothing:      0.1,
+		MaxIdle:        7 * 24 * 60 * 60 * 1000,
+		Buffer:         4096,
+	}
+}
+
+func New(c Config) (*Detector, error) {
+	if c.Window <= 0 {
+		return nil, errors.New("anomaly window must be positive")
+	}
+	if c.Sensitivity <= 0 {
+		return nil, errors.New("anomaly sensitivity must be positive")
+	}
+	if c.Smoothing <= 0 || c.Smoothing > 1 {
+		return nil, errors.New("anomaly smoothing must be within ]0, 1]")
+	}
+	return &Detector{config: c, stacks: make(map[string]*baseline)}, nil
+}
+
+// Run watches the connections published on the bus and publishes an
+// ANOMALY event for each anomaly, until the subscription ends.
+func (d *Detector) Run(events *bus.Bus) {
+	sub := events.Subscribe("anomaly", d.config.Buffer, bus.DropOldest)
+	defer sub.Close()
+	for e := range sub.Events() {
+		if e.Type != bus.CONNECTION_OBSERVED || e.Connection == nil {
+			continue
+		}
+		if reason, ok := d.Observe(e.Connection, e.Time); ok {
+			events.Publish(bus.Event{Type: bus.ANOMALY, Connection: e.Connection, Reason: reason, Span: e.Span})
+		}
+	}
+}
+
+func stackOf(c *graph.Connection) string {
+	if c.SrcNode != nil {
+		return c.SrcNode.Stack
+	}
+	if c.DstNode != nil {
+		return c.DstNode.Stack
+	}
+	return ""
+}
+
+// endpoint names a side of a connection by stack and service, or by name for
+// containers outside of a service, as graph.Component.Key does. Unknown
+// containers keep their id.
+func endpoint(n *graph.Node, id string) string {
+	if n == nil {
+		return id
+	}
+	if n.Service != "" {
+		return n.Stack + "/" + n.Service
+	}
+	if n.Name != "" {
+		return n.Stack + "/" + n.Name
+	}
+	return n.Stack + "/" + id
+}
+
+// sweep forgets the edges idle for MaxIdle, and the stacks left without edges.
+func (d *Detector) sweep(at time.Time) {
+	if d.config.MaxIdle <= 0 || at.Sub(d.swept) < SWEEP_INTERVAL {
+		return
+	}
+	d.swept = at
+	idle := time.Duration(d.config.MaxIdle) * time.Millisecond
+	for stack, b := range d.stacks {
+		for key, e := range b.edges {
+			if at.Sub(e.seen) > idle {
+				delete(b.edges, key)
+			}
+		}
+		if len(b.edges) == 0 && at.Sub(b.start) > idle {
+			delete(d.stacks, stack)
+		}
+	}
+}
+
+// Observe feeds a connection into the baseline of its source stack and
+// returns the reason of the anomaly it reveals, if any.
+func (d *Detector) Observe(c *graph.Connection, at time.Time) (string, bool) {
+	window := time.Duration(d.config.Window) * time.Millisecond
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(at)
+	stack := stackOf(c)
+	b, ok := d.stacks[stack]
+	if !ok {
+		b = &baseline{start: at, edges: make(map[[2]string]*edge)}
+		d.stacks[stack] = b
+	}
+	learning := at.Sub(b.start) < time.Duration(d.config.LearningPeriod)*time.Millisecond
+
+	src, dst := endpoint(c.SrcNode, c.Src), endpoint(c.DstNode, c.Dst)
+	key := [2]string{src, dst}
+	e, ok := b.edges[key]
+	if !ok {
+		b.edges[key] = &edge{start: at, seen: at, bytes: uint64(c.Size)}
+		if learning {
+			return "", false
+		}
+		return d.raise(NEW_EDGE, stack, c, fmt.Sprintf("new connection %s -> %s in stack %s", src, dst, stack))
+	}
+	e.seen = at
+
+	if elapsed := at.Sub(e.start); elapsed >= window {
+		d.roll(e)
+		e.start = e.start.Add(elapsed / window * window)
+	}
+	e.bytes += uint64(c.Size)
+	if learning || e.flagged || e.samples < d.config.MinSamples {
+		return "", false
+	}
+	rate := float64(e.bytes) / window.Seconds()
+	threshold := e.mean + d.config.Sensitivity*math.Sqrt(e.vari)
+	if rate <= threshold {
+		return "", false
+	}
+	e.flagged = true
+	return d.raise(TRAFFIC_SPIKE, stack, c, fmt.Sprintf("traffic %s -> %s at %.0f B/s, baseline %.0f B/s", src, dst, rate, e.mean))
+}
+
+// roll folds the current window of an edge into its baseline.
+func (d *Detector) roll(e *edge) {
+	rate := float64(e.bytes) / (time.Duration(d.config.Window) * time.Millisecond).Seconds()
+	if e.samples == 0 {
+		e.mean = rate
+	} else {
+		alpha := d.config.Smoothing
+		diff := rate - e.mean
+		e.mean += alpha * diff
+		e.vari = (1 - alpha) * (e.vari + alpha*diff*diff)
+	}
+	e.samples++
+	e.bytes = 0
+	e.flagged = false
+}
+
+func (d *Detector) raise(kind, stack string, c *graph.Connection, reason string) (string, bool) {
+	metrics.Anomalies.WithLabelValues(kind).Inc()
+	log.WithField("kind", kind).WithField("stack", stack).WithField("source", c.Src).WithField("destination", c.Dst).Warn("Anomaly detected")
+	return reason, true
+}
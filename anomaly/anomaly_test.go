@@ -0,0 +1,160 @@
+package anomaly
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Enabled:        true,
+		LearningPeriod: 60000,
+		Window:         1000,
+		Sensitivity:    3,
+		MinSamples:     5,
+		Smoothing:      0.2,
+		Buffer:         16,
+	}
+}
+
+func connection(src, dst string, size uint32) *graph.Connection {
+	return &graph.Connection{
+		Src:     src,
+		Dst:     dst,
+		Size:    size,
+		SrcNode: &graph.Node{Id: src, Name: src, Stack: "web"},
+		DstNode: &graph.Node{Id: dst, Name: dst, Stack: "web"},
+	}
+}
+
+func newDetector(t *testing.T, c Config) *Detector {
+	d, err := New(c)
+	assert.Nil(t, err)
+	return d
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, change := range []func(*Config){
+		func(c *Config) { c.Window = 0 },
+		func(c *Config) { c.Sensitivity = 0 },
+		func(c *Config) { c.Smoothing = 0 },
+		func(c *Config) { c.Smoothing = 1.5 },
+	} {
+		c := testConfig()
+		change(&c)
+		_, err := New(c)
+		assert.Error(t, err)
+	}
+}
+
+func TestNewEdge(t *testing.T) {
+	d := newDetector(t, testConfig())
+	start := time.Now()
+
+	_, raised := d.Observe(connection("a", "b", 10), start)
+	assert.False(t, raised)
+	_, raised = d.Observe(connection("a", "c", 10), start.Add(30*time.Second))
+	assert.False(t, raised)
+
+	reason, raised := d.Observe(connection("b", "c", 10), start.Add(time.Minute))
+	assert.True(t, raised)
+	assert.Contains(t, reason, "new connection web/b -> web/c")
+
+	_, raised = d.Observe(connection("b", "c", 10), start.Add(time.Minute))
+	assert.False(t, raised)
+	_, raised = d.Observe(connection("a", "b", 10), start.Add(time.Minute))
+	assert.False(t, raised)
+}
+
+func TestTrafficSpike(t *testing.T) {
+	d := newDetector(t, testConfig())
+	start := time.Now()
+	at := start
+	for i := 0; i < 120; i++ {
+		size := uint32(100)
+		if i%2 == 0 {
+			size = 120
+		}
+		_, raised := d.Observe(connection("a", "b", size), at)
+		assert.False(t, raised)
+		at = at.Add(time.Second)
+	}
+
+	_, raised := d.Observe(connection("a", "b", 100), at)
+	assert.False(t, raised)
+	reason, raised := d.Observe(connection("a", "b", 5000), at.Add(100*time.Millisecond))
+	assert.True(t, raised)
+	assert.Contains(t, reason, "traffic web/a -> web/b")
+
+	// Raised once per window.
+	_, raised = d.Observe(connection("a", "b", 5000), at.Add(200*time.Millisecond))
+	assert.False(t, raised)
+}
+
+func TestNoSpikeWhileLearning(t *testing.T) {
+	d := newDetector(t, testConfig())
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		d.Observe(connection("a", "b", 100), start.Add(time.Duration(i)*time.Second))
+	}
+	_, raised := d.Observe(connection("a", "b", 100000), start.Add(10*time.Second))
+	assert.False(t, raised)
+}
+
+func TestRun(t *testing.T) {
+	c := testConfig()
+	c.LearningPeriod = 0
+	b := bus.New()
+	sub := b.Subscribe("test", 10, bus.DropNewest)
+	defer sub.Close()
+	go newDetector(t, c).Run(b)
+
+	assert.Eventually(t, func() bool {
+		b.Publish(bus.Event{Type: bus.CONNECTION_OBSERVED, Connection: connection("a", "b", 10)})
+		for {
+			select {
+			case e := <-sub.Events():
+				if e.Type == bus.ANOMALY {
+					assert.Contains(t, e.Reason, "new connection")
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedeploy(t *testing.T) {
+	d := newDetector(t, testConfig())
+	start := time.Now()
+	api := connection("api-1", "db-1", 10)
+	api.SrcNode.Service, api.DstNode.Service = "api", "db"
+	d.Observe(api, start)
+
+	redeployed := connection("api-2", "db-2", 10)
+	redeployed.SrcNode.Service, redeployed.DstNode.Service = "api", "db"
+	_, raised := d.Observe(redeployed, start.Add(2*time.Minute))
+	assert.False(t, raised)
+}
+
+func TestIdleEdgesExpire(t *testing.T) {
+	c := testConfig()
+	c.MaxIdle = 120000
+	d := newDetector(t, c)
+	start := time.Now()
+	d.Observe(connection("a", "b", 10), start)
+	d.Observe(connection("a", "c", 10), start.Add(2*time.Minute))
+	assert.Len(t, d.stacks["web"].edges, 2)
+
+	reason, raised := d.Observe(connection("a", "c", 10), start.Add(5*time.Minute))
+	assert.False(t, raised)
+	assert.Empty(t, reason)
+	assert.Len(t, d.stacks["web"].edges, 1)
+
+	_, raised = d.Observe(connection("a", "b", 10), start.Add(6*time.Minute))
+	assert.True(t, raised)
+}
@@ -1,13 +1,35 @@
 package main
 
 import (
+	"docker-visualizer/aggregator/anomaly"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/certs"
+	"docker-visualizer/aggregator/config"
+	"docker-visualizer/aggregator/cors"
 	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/health"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
 	"docker-visualizer/aggregator/operations"
+	"docker-visualizer/aggregator/policy"
+	"docker-visualizer/aggregator/queue"
+	"docker-visualizer/aggregator/ratelimit"
 	"docker-visualizer/aggregator/rest"
+	"docker-visualizer/aggregator/sink"
 	"docker-visualizer/aggregator/sse"
+	"docker-visualizer/aggregator/tracing"
+	"docker-visualizer/aggregator/traffic"
 	"docker-visualizer/aggregator/utils"
 	"docker-visualizer/aggregator/version"
+	"docker-visualizer/aggregator/webhook"
+	"flag"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"time"
 )
 
 var (
@@ -16,19 +38,131 @@ var (
 	BRANCH  string
 )
 
+const (
+	HEALTH_INTERVAL = 5 * time.Second
+)
+
+var configFile = flag.String("config", "", "path to the JSON configuration file")
+
 func init() {
 	version.Info(VERSION, COMMIT, BRANCH)
 }
 
+func startSink(c sink.Config, events *bus.Bus) {
+	p, err := sink.NewPublisher(c.Url)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot create message broker publisher")
+	}
+	s, err := sink.New(p, c)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot create message broker sink")
+	}
+	log.WithField("url", c.Url).WithField("topic", c.Topic).Info("Starting message broker sink")
+	go s.Run(events)
+}
+
+// grpcCredentials serves the agent facing gRPC server over TLS, requiring
+// client certificates when a client CA is configured.
+func grpcCredentials(c certs.Config) grpc.ServerOption {
+	store, err := certs.NewStore(c)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot load grpc TLS certificates")
+	}
+	go store.Watch()
+	log.WithField("cert", c.Cert).WithField("mtls", c.ClientCA != "").Info("Serving grpc over TLS")
+	return grpc.Creds(credentials.NewTLS(store.ServerConfig()))
+}
+
 func main() {
-	streamChannel := make(chan []byte)
-	go sse.Start(&streamChannel)
+	flag.Parse()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot load configuration")
+	}
+	if err := logging.Setup(cfg.Logging); err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot setup logging")
+	}
+	if *checkCycles {
+		os.Exit(cyclesCheck(cfg.Backend))
+	}
+	shutdown, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot setup tracing")
+	}
+	defer shutdown(context.Background())
+
+	h := health.New()
+	h.Set("schema", health.ErrNotStarted)
+	h.Set("grpc", health.ErrNotStarted)
+	h.Set("sse", health.ErrNotStarted)
+
+	a, err := auth.New(cfg.Auth)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot setup authentication")
+	}
+	if !a.Enabled() {
+		log.Warn("No authentication configured, topology is readable by anyone")
+	}
 
-	conn := utils.SetupGrpcConnection()
+	c, err := cors.New(cfg.Cors)
+	if err != nil {
+		log.WithField("Error", err.Error()).Fatal("Cannot setup CORS")
+	}
+
+	events := bus.New()
+	go sse.Start(events, h, a, c)
+
+	hooks := webhook.NewDispatcher(cfg.Webhooks)
+	go hooks.Run(events)
+
+	if cfg.Sink.Url != "" {
+		startSink(cfg.Sink, events)
+	}
+
+	if cfg.Anomaly.Enabled {
+		detector, err := anomaly.New(cfg.Anomaly)
+		if err != nil {
+			log.WithField("Error", err.Error()).Fatal("Cannot setup anomaly detection")
+		}
+		go detector.Run(events)
+	}
+
+	conn := utils.SetupGrpcConnection(cfg.Backend)
 	defer conn.Close()
 
-	g := graph.NewGraphClient(conn)
-	restServer := rest.NewRestServer(g)
+	g := metrics.InstrumentGraph(tracing.TraceGraph(graph.NewGraphClient(conn)))
+	h.AddCheck("graph", g.Ping)
+	go func() {
+		report := func(err error) { h.Set("schema", err) }
+		if err := graph.MaintainSchema(g, conn, cfg.Backend.Retry, report); err != nil {
+			log.WithField("Error", err.Error()).Fatal("Error while initializing schema")
+		}
+	}()
+
+	if cfg.Edges.TTL > 0 {
+		go operations.ExpireEdges(cfg.Edges, events, g)
+	}
+
+	restServer := rest.NewRestServer(g, a)
+	webhook.NewHandler(hooks).Register(restServer.GetRouter(), a)
+	h.Register(restServer.GetRouter())
+	var engine *policy.Engine
+	if cfg.Policy.File != "" {
+		if engine, err = policy.New(cfg.Policy); err != nil {
+			log.WithField("Error", err.Error()).Fatal("Cannot load policy")
+		}
+		policy.NewHandler(engine).Register(restServer.GetRouter(), a)
+		log.WithField("file", cfg.Policy.File).Info("Enforcing communication policy")
+	}
+	if cfg.Traffic.Enabled {
+		store := traffic.New(cfg.Traffic)
+		go store.Run(events)
+		traffic.NewHandler(store).Register(restServer.GetRouter(), a)
+	}
+	restServer.GetRouter().Handler("GET", "/metrics", metrics.Handler())
+	restServer.Use(ratelimit.NewHttpLimiter(cfg.RateLimit, a, "/metrics", "/healthz", "/readyz").Handler)
+	restServer.Use(c.Handler)
+	restServer.Use(logging.AccessLog)
 
 	go restServer.Listen()
 
@@ -36,6 +170,51 @@ func main() {
 
 	log.Info("Starting grpc server")
 
-	operations.NewGrpcOperations(&streamChannel, g).Serve(listener)
+	var q *queue.Queue
+	if cfg.Queue.Dir != "" {
+		if q, err = queue.Open(cfg.Queue); err != nil {
+			log.WithField("Error", err.Error()).Fatal("Cannot open mutation queue")
+		}
+		defer q.Close()
+		log.WithField("dir", cfg.Queue.Dir).WithField("pending", q.Len()).Info("Mutation queue opened")
+	}
+
+	access := &logging.GrpcAccessLog{}
+	unary := []grpc.UnaryServerInterceptor{
+		tracing.UnaryServerInterceptor,
+		metrics.UnaryServerInterceptor,
+		access.UnaryServerInterceptor,
+	}
+	stream := []grpc.StreamServerInterceptor{
+		tracing.StreamServerInterceptor,
+		metrics.StreamServerInterceptor,
+		access.StreamServerInterceptor,
+		a.StreamServerInterceptor,
+	}
+	if len(cfg.Agents) > 0 {
+		agents := auth.NewAgentAuth(cfg.Agents)
+		unary = append(unary, agents.UnaryServerInterceptor)
+		stream = append(stream, agents.StreamServerInterceptor)
+	} else {
+		log.Warn("No agents configured, any client may report containers")
+	}
+	limiter := ratelimit.NewGrpcLimiter(cfg.RateLimit)
+	unary = append(unary, limiter.UnaryServerInterceptor)
+	stream = append(stream, limiter.StreamServerInterceptor)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+	if cfg.GrpcTLS.Cert != "" {
+		opts = append(opts, grpcCredentials(cfg.GrpcTLS))
+	}
+	grpcServer := operations.NewGrpcOperations(events, g, h, q, engine, opts...)
+	h.Set("grpc", nil)
+	go h.Watch(HEALTH_INTERVAL)
+
+	if err := grpcServer.Serve(listener); err != nil {
+		h.Set("grpc", err)
+		log.WithField("Error", err.Error()).Fatal("grpc server error")
+	}
 
 }
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"docker-visualizer/aggregator/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const (
+	ALL_HOSTS = "*"
+	// AGENT_SERVICE is the gRPC service reserved to authenticated agents.
+	AGENT_SERVICE = "/containers.ContainerService/"
+)
+
+// Agent is a reporting agent, identified either by a token sent in the
+// "authorization: Bearer" metadata or by the common name of its client
+// certificate. It may only report containers of its Hosts; ALL_HOSTS
+// grants every host.
+type Agent struct {
+	Name        string   `json:"name"`
+	Token       string   `json:"token,omitempty"`
+	Certificate string   `json:"certificate,omitempty"`
+	Hosts       []string `json:"hosts"`
+}
+
+type AgentAuth struct {
+	agents []Agent
+}
+
+type agentKey struct{}
+
+func NewAgentAuth(agents []Agent) *AgentAuth {
+	return &AgentAuth{agents: agents}
+}
+
+// AllowedHost tells whether the agent may report for the host. A nil agent,
+// as found when agents are not authenticated, may report for any host.
+func (a *Agent) AllowedHost(host string) bool {
+	if a == nil {
+		return true
+	}
+	for _, h := range a.Hosts {
+		if h == ALL_HOSTS || h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity returns the agent without its credentials.
+func (a *Agent) Identity() *Agent {
+	if a == nil {
+		return nil
+	}
+	return &Agent{Name: a.Name, Hosts: a.Hosts}
+}
+
+func WithAgent(ctx context.Context, a *Agent) context.Context {
+	return context.WithValue(ctx, agentKey{}, a)
+}
+
+// AgentFromContext returns the agent of an authenticated call, or nil.
+func AgentFromContext(ctx context.Context) *Agent {
+	a, _ := ctx.Value(agentKey{}).(*Agent)
+	return a
+}
+
+func (a *AgentAuth) Authenticate(ctx context.Context) (*Agent, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, h := range md.Get("authorization") {
+			if len(h) <= 7 || !strings.EqualFold(h[:7], "bearer ") {
+				continue
+			}
+			token := []byte(strings.TrimSpace(h[7:]))
+			for i := range a.agents {
+				if t := a.agents[i].Token; t != "" && subtle.ConstantTimeCompare([]byte(t), token) == 1 {
+					return &a.agents[i], nil
+				}
+			}
+			return nil, status.Error(codes.Unauthenticated, ErrInvalid.Error())
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			name := info.State.VerifiedChains[0][0].Subject.CommonName
+			for i := range a.agents {
+				if c := a.agents[i].Certificate; c != "" && c == name {
+					return &a.agents[i], nil
+				}
+			}
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+}
+
+func (a *AgentAuth) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, AGENT_SERVICE) {
+		return handler(ctx, req)
+	}
+	agent, err := a.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logging.SetIdentity(ctx, agent.Name)
+	return handler(WithAgent(ctx, agent), req)
+}
+
+type agentStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *agentStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *AgentAuth) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !strings.HasPrefix(info.FullMethod, AGENT_SERVICE) {
+		return handler(srv, ss)
+	}
+	agent, err := a.Authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	logging.SetIdentity(ss.Context(), agent.Name)
+	return handler(srv, &agentStream{ServerStream: ss, ctx: WithAgent(ss.Context(), agent)})
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"docker-visualizer/aggregator/logging"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func agentContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAgentAuthenticate(t *testing.T) {
+	a := NewAgentAuth([]Agent{{Name: "node-1", Token: "one", Hosts: []string{"host-1"}}})
+
+	agent, err := a.Authenticate(agentContext("one"))
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1", agent.Name)
+
+	_, err = a.Authenticate(agentContext("two"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.Authenticate(context.Background())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAgentUnaryInterceptor(t *testing.T) {
+	a := NewAgentAuth([]Agent{{Name: "node-1", Token: "one", Hosts: []string{"host-1"}}})
+	var agent *Agent
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		agent = AgentFromContext(ctx)
+		return nil, nil
+	}
+
+	_, err := a.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: AGENT_SERVICE + "AddNode"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = a.UnaryServerInterceptor(agentContext("one"), nil, &grpc.UnaryServerInfo{FullMethod: AGENT_SERVICE + "AddNode"}, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1", agent.Name)
+
+	agent = nil
+	_, err = a.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/events.TopologyService/WatchTopology"}, handler)
+	assert.Nil(t, err)
+	assert.Nil(t, agent)
+}
+
+func TestAgentAccessLog(t *testing.T) {
+	a := NewAgentAuth([]Agent{{Name: "node-1", Token: "one", Hosts: []string{"host-1"}}})
+	hook := test.NewLocal(logging.For("access").Logger)
+	access := &logging.GrpcAccessLog{}
+	info := &grpc.UnaryServerInfo{FullMethod: AGENT_SERVICE + "AddNode"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return a.UnaryServerInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	}
+
+	_, err := access.UnaryServerInterceptor(agentContext("one"), nil, info, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1", hook.LastEntry().Data["agent"])
+
+	_, err = access.UnaryServerInterceptor(agentContext("two"), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.NotContains(t, hook.LastEntry().Data, "agent")
+}
+
+func TestAgentAllowedHost(t *testing.T) {
+	var none *Agent
+	assert.True(t, none.AllowedHost("host-1"))
+	assert.Nil(t, none.Identity())
+
+	a := &Agent{Name: "node-1", Token: "one", Hosts: []string{"host-1"}}
+	assert.True(t, a.AllowedHost("host-1"))
+	assert.False(t, a.AllowedHost("host-2"))
+	assert.Equal(t, "", a.Identity().Token)
+	assert.True(t, (&Agent{Hosts: []string{ALL_HOSTS}}).AllowedHost("host-2"))
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	a, _ := New(Config{Tokens: []Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	var p *Principal
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		p = FromContext(ss.Context())
+		return nil
+	}
+	watch := &grpc.StreamServerInfo{FullMethod: TOPOLOGY_SERVICE + "WatchTopology"}
+
+	err := a.StreamServerInterceptor(nil, &agentStream{ctx: context.Background()}, watch, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	err = a.StreamServerInterceptor(nil, &agentStream{ctx: agentContext("secret")}, watch, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "ui", p.Name)
+
+	var none *Auth
+	err = none.StreamServerInterceptor(nil, &agentStream{ctx: context.Background()}, watch, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, Anonymous, p)
+}
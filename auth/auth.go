@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"docker-visualizer/aggregator/logging"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var log = logging.For("auth")
+
+const (
+	ALL_STACKS = "*"
+	// TOKEN_PARAM carries a bearer token for clients that cannot set headers,
+	// such as browser EventSource.
+	TOKEN_PARAM = "access_token"
+	// TOPOLOGY_SERVICE is the gRPC service streaming the topology to clients.
+	TOPOLOGY_SERVICE = "/events.TopologyService/"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrInvalid         = errors.New("invalid credentials")
+)
+
+type Config struct {
+	Tokens    []Token   `json:"tokens"`
+	JWT       JWTConfig `json:"jwt"`
+	BasicFile string    `json:"basic_file"`
+}
+
+// Principal is an authenticated caller. Stacks lists the stacks it may see;
+// ALL_STACKS grants every stack.
+type Principal struct {
+	Name   string   `json:"name"`
+	Stacks []string `json:"stacks"`
+}
+
+// Anonymous is the principal of every request when authentication is disabled.
+var Anonymous = &Principal{Name: "anonymous", Stacks: []string{ALL_STACKS}}
+
+// Authenticator identifies the caller of a request. It returns a nil
+// principal and no error when the request carries no credentials it knows.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Auth tries its authenticators in turn. A nil or empty Auth lets every
+// request in as Anonymous.
+type Auth struct {
+	authenticators []Authenticator
+}
+
+type contextKey struct{}
+
+func New(c Config) (*Auth, error) {
+	a := &Auth{}
+	if len(c.Tokens) > 0 {
+		a.authenticators = append(a.authenticators, NewTokenAuthenticator(c.Tokens))
+	}
+	if len(c.JWT.Keys) > 0 {
+		a.authenticators = append(a.authenticators, NewJWTAuthenticator(c.JWT))
+	}
+	if c.BasicFile != "" {
+		b, err := NewBasicAuthenticator(c.BasicFile)
+		if err != nil {
+			return nil, err
+		}
+		a.authenticators = append(a.authenticators, b)
+	}
+	return a, nil
+}
+
+func (a *Auth) Enabled() bool {
+	return a != nil && len(a.authenticators) > 0
+}
+
+func (a *Auth) Authenticate(r *http.Request) (*Principal, error) {
+	if !a.Enabled() {
+		return Anonymous, nil
+	}
+	for _, authenticator := range a.authenticators {
+		p, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// Wrap authenticates the request before calling h with the principal stored
+// in the request context.
+func (a *Auth) Wrap(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if r, ok := a.authenticate(w, r); ok {
+			h(w, r, params)
+		}
+	}
+}
+
+// Handler is Wrap for plain http handlers.
+func (a *Auth) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r, ok := a.authenticate(w, r); ok {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authenticate reuses the principal already authenticated by a middleware,
+// such as the rate limiter, before trying the credentials of the request.
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if FromContext(r.Context()) != nil {
+		return r, true
+	}
+	p, err := a.Authenticate(r)
+	if err != nil {
+		log.WithField("remote", r.RemoteAddr).WithField("error", err).Warn("Authentication failed")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aggregator"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+	return r.WithContext(WithPrincipal(r.Context(), p)), true
+}
+
+// AuthenticateContext authenticates a gRPC call from the "authorization"
+// metadata, as Authenticate does for the Authorization header.
+func (a *Auth) AuthenticateContext(ctx context.Context) (*Principal, error) {
+	r := &http.Request{Header: make(http.Header), URL: &url.URL{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, h := range md.Get("authorization") {
+			r.Header.Add("Authorization", h)
+		}
+	}
+	return a.Authenticate(r)
+}
+
+// StreamServerInterceptor authenticates the calls to TOPOLOGY_SERVICE and
+// stores their principal in the stream context.
+func (a *Auth) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !strings.HasPrefix(info.FullMethod, TOPOLOGY_SERVICE) {
+		return handler(srv, ss)
+	}
+	p, err := a.AuthenticateContext(ss.Context())
+	if err != nil {
+		log.WithField("method", info.FullMethod).WithField("error", err).Warn("Authentication failed")
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return handler(srv, &agentStream{ServerStream: ss, ctx: WithPrincipal(ss.Context(), p)})
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Allowed tells whether the principal may see the given stack. A nil
+// principal sees nothing.
+func (p *Principal) Allowed(stack string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Stacks {
+		if s == ALL_STACKS || s == stack {
+			return true
+		}
+	}
+	return false
+}
+
+// bearer returns the token of the Authorization header or of the
+// access_token query parameter.
+func bearer(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return r.URL.Query().Get(TOKEN_PARAM)
+}
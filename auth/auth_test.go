@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, kid, secret string, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid})
+	c, err := json.Marshal(claims)
+	assert.Nil(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func request(header string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set("Authorization", header)
+	}
+	return r
+}
+
+func TestDisabled(t *testing.T) {
+	var a *Auth
+	p, err := a.Authenticate(request(""))
+	assert.Nil(t, err)
+	assert.True(t, p.Allowed("any"))
+
+	a, _ = New(Config{})
+	assert.False(t, a.Enabled())
+}
+
+func TestTokens(t *testing.T) {
+	a, _ := New(Config{Tokens: []Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+
+	p, err := a.Authenticate(request("Bearer secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ui", p.Name)
+	assert.True(t, p.Allowed("web"))
+	assert.False(t, p.Allowed("db"))
+
+	r := httptest.NewRequest(http.MethodGet, "/?access_token=secret", nil)
+	p, err = a.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "ui", p.Name)
+
+	_, err = a.Authenticate(request("Bearer wrong"))
+	assert.Equal(t, ErrUnauthenticated, err)
+	_, err = a.Authenticate(request(""))
+	assert.Equal(t, ErrUnauthenticated, err)
+}
+
+func TestJWT(t *testing.T) {
+	a, _ := New(Config{JWT: JWTConfig{
+		Keys:     []Key{{Id: "k1", Secret: "one"}, {Id: "k2", Secret: "two"}},
+		Issuer:   "issuer",
+		Audience: "aggregator",
+	}})
+	valid := map[string]interface{}{
+		"sub":    "alice",
+		"iss":    "issuer",
+		"aud":    []string{"aggregator"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"stacks": []string{"web"},
+	}
+
+	p, err := a.Authenticate(request("Bearer " + sign(t, "k2", "two", valid)))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", p.Name)
+	assert.True(t, p.Allowed("web"))
+
+	_, err = a.Authenticate(request("Bearer " + sign(t, "k1", "two", valid)))
+	assert.Equal(t, ErrInvalid, err)
+
+	expired := map[string]interface{}{"iss": "issuer", "aud": "aggregator", "exp": time.Now().Add(-time.Hour).Unix()}
+	_, err = a.Authenticate(request("Bearer " + sign(t, "k1", "one", expired)))
+	assert.Equal(t, ErrInvalid, err)
+
+	other := map[string]interface{}{"iss": "issuer", "aud": "other"}
+	_, err = a.Authenticate(request("Bearer " + sign(t, "k1", "one", other)))
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestBasic(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	f, _ := ioutil.TempFile("", "users")
+	defer os.Remove(f.Name())
+	f.WriteString("# users\nbob:" + string(hash) + ":web,db\n")
+	f.Close()
+
+	a, err := New(Config{BasicFile: f.Name()})
+	assert.Nil(t, err)
+
+	r := request("")
+	r.SetBasicAuth("bob", "password")
+	p, err := a.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", p.Name)
+	assert.True(t, p.Allowed("db"))
+
+	r.SetBasicAuth("bob", "wrong")
+	_, err = a.Authenticate(r)
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestWrap(t *testing.T) {
+	a, _ := New(Config{Tokens: []Token{{Token: "secret", Name: "ui", Stacks: []string{ALL_STACKS}}}})
+	var principal *Principal
+	h := a.Wrap(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		principal = FromContext(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	h(w, request(""), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, principal)
+
+	w = httptest.NewRecorder()
+	h(w, request("Bearer secret"), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ui", principal.Name)
+	assert.True(t, principal.Allowed("any"))
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type user struct {
+	hash   []byte
+	stacks []string
+}
+
+// BasicAuthenticator checks HTTP basic credentials against a file of
+// "name:bcrypt hash:stack,stack" lines. Blank lines and lines starting
+// with # are ignored.
+type BasicAuthenticator struct {
+	users map[string]user
+}
+
+func NewBasicAuthenticator(path string) (*BasicAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &BasicAuthenticator{users: make(map[string]user)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, errors.New("malformed basic auth line: " + fields[0])
+		}
+		u := user{hash: []byte(fields[1])}
+		if len(fields) == 3 && fields[2] != "" {
+			u.stacks = strings.Split(fields[2], ",")
+		}
+		a.users[fields[0]] = u
+	}
+	return a, scanner.Err()
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	u, found := a.users[name]
+	if !found || bcrypt.CompareHashAndPassword(u.hash, []byte(password)) != nil {
+		return nil, ErrInvalid
+	}
+	return &Principal{Name: name, Stacks: u.stacks}, nil
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Token is a static bearer token granting access to some stacks.
+type Token struct {
+	Token  string   `json:"token"`
+	Name   string   `json:"name"`
+	Stacks []string `json:"stacks"`
+}
+
+// JWTConfig validates HMAC signed JWTs. The stacks of the principal come
+// from the "stacks" claim, its name from "sub".
+type JWTConfig struct {
+	Keys     []Key  `json:"keys"`
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+}
+
+// Key is a JWT signing secret, selected by the "kid" header of the token.
+type Key struct {
+	Id     string `json:"kid"`
+	Secret string `json:"secret"`
+}
+
+type TokenAuthenticator struct {
+	tokens []Token
+}
+
+type JWTAuthenticator struct {
+	config JWTConfig
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	Expires   int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	Stacks    []string        `json:"stacks"`
+}
+
+var algorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+var now = time.Now
+
+func NewTokenAuthenticator(tokens []Token) *TokenAuthenticator {
+	return &TokenAuthenticator{tokens: tokens}
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearer(r)
+	if token == "" {
+		return nil, nil
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &Principal{Name: t.Name, Stacks: t.Stacks}, nil
+		}
+	}
+	return nil, nil
+}
+
+func NewJWTAuthenticator(c JWTConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{config: c}
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearer(r)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalid
+	}
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, ErrInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if !a.verify(alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalid
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalid
+	}
+	t := now().Unix()
+	if claims.Expires != 0 && t >= claims.Expires {
+		return nil, ErrInvalid
+	}
+	if claims.NotBefore != 0 && t < claims.NotBefore {
+		return nil, ErrInvalid
+	}
+	if a.config.Issuer != "" && claims.Issuer != a.config.Issuer {
+		return nil, ErrInvalid
+	}
+	if a.config.Audience != "" && !hasAudience(claims.Audience, a.config.Audience) {
+		return nil, ErrInvalid
+	}
+	return &Principal{Name: claims.Subject, Stacks: claims.Stacks}, nil
+}
+
+func (a *JWTAuthenticator) verify(alg func() hash.Hash, kid, signed string, signature []byte) bool {
+	for _, k := range a.config.Keys {
+		if kid != "" && k.Id != kid {
+			continue
+		}
+		mac := hmac.New(alg, []byte(k.Secret))
+		mac.Write([]byte(signed))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hasAudience accepts the "aud" claim as a single string or a list.
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, a := range list {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
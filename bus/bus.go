@@ -0,0 +1,183 @@
+package bus
+
+import (
+	"context"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = logging.For("bus")
+
+type EventType string
+
+const (
+	NODE_ADDED          EventType = "NODE_ADDED"
+	NODE_REMOVED        EventType = "NODE_REMOVED"
+	NODE_UPDATED        EventType = "NODE_UPDATED"
+	CONNECTION_OBSERVED EventType = "CONNECTION_OBSERVED"
+	// EDGE_ADDED follows the CONNECTION_OBSERVED that created an edge.
+	EDGE_ADDED EventType = "EDGE_ADDED"
+	// EDGE_EXPIRED is raised when an edge without traffic is removed.
+	EDGE_EXPIRED EventType = "EDGE_EXPIRED"
+	// VIOLATION is raised on a connection forbidden by the policy.
+	VIOLATION EventType = "VIOLATION"
+	// ANOMALY is raised on a connection departing from the learned baseline.
+	ANOMALY EventType = "ANOMALY"
+)
+
+// Types lists every event type, each known to the JSON and protobuf
+// encodings, so that every transport forwards the same events.
+var Types = []EventType{NODE_ADDED, NODE_REMOVED, NODE_UPDATED, CONNECTION_OBSERVED, EDGE_ADDED, EDGE_EXPIRED, VIOLATION, ANOMALY}
+
+// Policy tells the bus what to do when a subscriber's buffer is full.
+type Policy int
+
+const (
+	// DropNewest discards the event being published.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest
+	// Disconnect closes the subscription so the consumer can resynchronize.
+	Disconnect
+)
+
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Node       *graph.Node
+	Connection *graph.Connection
+	// Reason explains why an alert such as VIOLATION or ANOMALY was raised.
+	Reason string
+	// Span is the publication span, for subscribers to continue the trace.
+	Span trace.SpanContext
+}
+
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]bool
+}
+
+type Subscription struct {
+	name    string
+	policy  Policy
+	events  chan Event
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	dropped uint64
+	bus     *Bus
+}
+
+func New() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]bool)}
+}
+
+// Nodes returns the nodes an event is about: the node itself for node events,
+// the source and destination for edge events. Unknown endpoints are nil.
+func (e Event) Nodes() []*graph.Node {
+	if e.Connection != nil {
+		return []*graph.Node{e.Connection.SrcNode, e.Connection.DstNode}
+	}
+	return []*graph.Node{e.Node}
+}
+
+// Publish hands the event to every subscriber without ever blocking the caller.
+func (b *Bus) Publish(e Event) {
+	b.PublishContext(context.Background(), e)
+}
+
+// PublishContext is Publish recording a span as a child of ctx.
+func (b *Bus) PublishContext(ctx context.Context, e Event) {
+	_, span := tracing.Tracer().Start(ctx, "bus.Publish", trace.WithAttributes(attribute.String("event.type", string(e.Type))))
+	defer span.End()
+	if !e.Span.IsValid() {
+		e.Span = span.SpanContext()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	span.SetAttributes(attribute.Int("bus.subscribers", len(b.subscriptions)))
+	for s := range b.subscriptions {
+		s.deliver(e)
+	}
+}
+
+func (b *Bus) Subscribe(name string, size int, policy Policy) *Subscription {
+	s := &Subscription{
+		name:   name,
+		policy: policy,
+		events: make(chan Event, size),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+	b.mu.Lock()
+	b.subscriptions[s] = true
+	log.WithField("subscriber", name).WithField("subscribers size", len(b.subscriptions)).Info("New bus subscriber")
+	b.mu.Unlock()
+	return s
+}
+
+func (b *Bus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	delete(b.subscriptions, s)
+	log.WithField("subscriber", s.name).WithField("subscribers size", len(b.subscriptions)).Info("Delete bus subscriber")
+	b.mu.Unlock()
+}
+
+func (s *Subscription) deliver(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	select {
+	case s.events <- e:
+		return
+	default:
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.events:
+		default:
+		}
+		s.events <- e
+	case Disconnect:
+		log.WithField("subscriber", s.name).Warn("Subscriber fell behind, disconnecting")
+		s.once.Do(func() { close(s.done) })
+		go s.bus.unsubscribe(s)
+	default:
+		log.WithField("subscriber", s.name).Debug("Subscriber buffer full, dropping event")
+	}
+}
+
+// Events is the stream of events delivered to the subscriber.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed once the subscription is closed or has been disconnected.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped returns how many events did not fit in the subscriber's buffer.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+	s.once.Do(func() { close(s.done) })
+}
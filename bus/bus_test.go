@@ -0,0 +1,96 @@
+package bus
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	b := New()
+	s1 := b.Subscribe("first", 1, DropNewest)
+	s2 := b.Subscribe("second", 1, DropNewest)
+
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "1"}})
+
+	e1 := <-s1.Events()
+	e2 := <-s2.Events()
+	assert.Equal(t, NODE_ADDED, e1.Type)
+	assert.Equal(t, "1", e2.Node.Id)
+	assert.False(t, e1.Time.IsZero())
+}
+
+func TestBus_DropNewest(t *testing.T) {
+	b := New()
+	s := b.Subscribe("test", 1, DropNewest)
+
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "1"}})
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "2"}})
+
+	assert.Equal(t, "1", (<-s.Events()).Node.Id)
+	assert.Equal(t, uint64(1), s.Dropped())
+}
+
+func TestBus_DropOldest(t *testing.T) {
+	b := New()
+	s := b.Subscribe("test", 1, DropOldest)
+
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "1"}})
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "2"}})
+
+	assert.Equal(t, "2", (<-s.Events()).Node.Id)
+	assert.Equal(t, uint64(1), s.Dropped())
+}
+
+func TestBus_Disconnect(t *testing.T) {
+	b := New()
+	s := b.Subscribe("test", 1, Disconnect)
+
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "1"}})
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "2"}})
+
+	<-s.Done()
+	assert.Equal(t, uint64(1), s.Dropped())
+}
+
+func TestBus_Close(t *testing.T) {
+	b := New()
+	s := b.Subscribe("test", 1, DropNewest)
+	s.Close()
+
+	b.Publish(Event{Type: NODE_ADDED, Node: &graph.Node{Id: "1"}})
+
+	assert.Len(t, s.Events(), 0)
+	assert.Len(t, b.subscriptions, 0)
+}
+
+func TestEvent_Nodes(t *testing.T) {
+	src := &graph.Node{Id: "1"}
+	dst := &graph.Node{Id: "2"}
+	e := Event{Type: CONNECTION_OBSERVED, Connection: &graph.Connection{SrcNode: src, DstNode: dst}}
+	assert.Equal(t, []*graph.Node{src, dst}, e.Nodes())
+}
+
+func TestEvent_MarshalClientEvent(t *testing.T) {
+	b, err := Event{Type: NODE_REMOVED, Node: &graph.Node{Id: "123"}}.MarshalClientEvent()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"action":"DELETE","payload":{"id":"123"}}`, string(b))
+
+	b, err = Event{Type: CONNECTION_OBSERVED, Connection: &graph.Connection{Src: "1", Dst: "2", Size: 3}}.MarshalClientEvent()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"action":"CONNECT","payload":{"source":"1","destination":"2","size":3}}`, string(b))
+
+	b, err = Event{Type: VIOLATION, Reason: "denied", Connection: &graph.Connection{SrcNode: &graph.Node{Id: "1"}, Size: 3}}.MarshalClientEvent()
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"action":"VIOLATION"`)
+	assert.Contains(t, string(b), `"reason":"denied"`)
+	assert.Contains(t, string(b), `"destination":null`)
+
+	b, err = Event{Type: ANOMALY, Reason: "new connection"}.MarshalClientEvent()
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"action":"ANOMALY"`)
+
+	b, err = Event{Type: EventType("UNKNOWN")}.MarshalClientEvent()
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+}
@@ -0,0 +1,77 @@
+package bus
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"encoding/json"
+)
+
+// ClientEvent is the JSON message the UI consumes.
+type ClientEvent struct {
+	Action  string      `json:"action"`
+	Payload interface{} `json:"payload"`
+}
+
+const (
+	EVENT_ADD       = "ADD"
+	EVENT_UPDATE    = "UPDATE"
+	EVENT_DELETE    = "DELETE"
+	EVENT_CONNECT   = "CONNECT"
+	EVENT_EDGE_ADD  = "EDGE_ADD"
+	EVENT_EDGE_DEL  = "EDGE_DELETE"
+	EVENT_VIOLATION = "VIOLATION"
+	EVENT_ANOMALY   = "ANOMALY"
+)
+
+// Alert is the payload of the events flagging a connection.
+type Alert struct {
+	Source      *graph.Node `json:"source"`
+	Destination *graph.Node `json:"destination"`
+	Size        uint32      `json:"size"`
+	Reason      string      `json:"reason"`
+}
+
+// ClientEvent converts the event into the message sent to UI clients.
+// It returns false for events the UI does not know about.
+func (e Event) ClientEvent() (ClientEvent, bool) {
+	switch e.Type {
+	case NODE_ADDED:
+		return ClientEvent{Action: EVENT_ADD, Payload: e.Node}, true
+	case NODE_UPDATED:
+		return ClientEvent{Action: EVENT_UPDATE, Payload: e.Node}, true
+	case NODE_REMOVED:
+		return ClientEvent{Action: EVENT_DELETE, Payload: struct {
+			Id string `json:"id"`
+		}{Id: e.Node.Id}}, true
+	case CONNECTION_OBSERVED:
+		return ClientEvent{Action: EVENT_CONNECT, Payload: e.Connection}, true
+	case EDGE_ADDED:
+		return ClientEvent{Action: EVENT_EDGE_ADD, Payload: e.Connection}, true
+	case EDGE_EXPIRED:
+		return ClientEvent{Action: EVENT_EDGE_DEL, Payload: e.Connection}, true
+	case VIOLATION:
+		return ClientEvent{Action: EVENT_VIOLATION, Payload: e.alert()}, true
+	case ANOMALY:
+		return ClientEvent{Action: EVENT_ANOMALY, Payload: e.alert()}, true
+	}
+	return ClientEvent{}, false
+}
+
+// MarshalClientEvent returns the JSON client event, or nil for events the UI
+// does not know about.
+func (e Event) MarshalClientEvent() ([]byte, error) {
+	event, ok := e.ClientEvent()
+	if !ok {
+		return nil, nil
+	}
+	return json.Marshal(event)
+}
+
+func (e Event) alert() Alert {
+	a := Alert{Reason: e.Reason}
+	if c := e.Connection; c != nil {
+		a.Source = c.SrcNode
+		a.Destination = c.DstNode
+		a.Size = c.Size
+	}
+	return a
+}
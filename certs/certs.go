@@ -0,0 +1,251 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"docker-visualizer/aggregator/logging"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var log = logging.For("certs")
+
+const (
+	RELOAD_INTERVAL = 30000
+)
+
+// Config describes the certificates of one end of a TLS connection.
+// Cert and Key are the local certificate. On a server, ClientCA enables
+// mutual TLS: clients must present a certificate signed by it. On a client,
+// CA verifies the server, whose name defaults to the dialed host.
+type Config struct {
+	Cert           string `json:"cert"`
+	Key            string `json:"key"`
+	CA             string `json:"ca"`
+	ClientCA       string `json:"client_ca"`
+	ServerName     string `json:"server_name"`
+	ReloadInterval int    `json:"reload_interval_ms"`
+}
+
+// Store keeps the certificates of a Config in memory and reloads them when
+// their files change on disk, so that rotated certificates are picked up by
+// new connections without a restart.
+type Store struct {
+	config   Config
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	ca       *x509.CertPool
+	clientCA *x509.CertPool
+	modified map[string]time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{ReloadInterval: RELOAD_INTERVAL}
+}
+
+// Enabled tells whether TLS is configured at all.
+func (c Config) Enabled() bool {
+	return c.Cert != "" || c.CA != ""
+}
+
+func NewStore(c Config) (*Store, error) {
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, errors.New("tls certificate and key must be set together")
+	}
+	s := &Store{config: c, modified: make(map[string]time.Time)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) files() []string {
+	var files []string
+	for _, f := range []string{s.config.Cert, s.config.Key, s.config.CA, s.config.ClientCA} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (s *Store) load() error {
+	var cert *tls.Certificate
+	if s.config.Cert != "" {
+		c, err := tls.LoadX509KeyPair(s.config.Cert, s.config.Key)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	ca, err := loadPool(s.config.CA)
+	if err != nil {
+		return err
+	}
+	clientCA, err := loadPool(s.config.ClientCA)
+	if err != nil {
+		return err
+	}
+	modified := make(map[string]time.Time)
+	for _, f := range s.files() {
+		if info, err := os.Stat(f); err == nil {
+			modified[f] = info.ModTime()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = cert
+	s.ca = ca
+	s.clientCA = clientCA
+	s.modified = modified
+	return nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("no certificate found in " + path)
+	}
+	return pool, nil
+}
+
+func (s *Store) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, f := range s.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(s.modified[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads the certificates again if one of their files changed. On
+// error the previous certificates are kept.
+func (s *Store) Reload() error {
+	if !s.changed() {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	log.WithField("cert", s.config.Cert).Info("TLS certificates reloaded")
+	return nil
+}
+
+// Watch polls the certificate files forever.
+func (s *Store) Watch() {
+	interval := s.config.ReloadInterval
+	if interval <= 0 {
+		interval = RELOAD_INTERVAL
+	}
+	for range time.Tick(time.Duration(interval) * time.Millisecond) {
+		if err := s.Reload(); err != nil {
+			log.WithField("cert", s.config.Cert).WithField("error", err).Error("Cannot reload TLS certificates")
+		}
+	}
+}
+
+func (s *Store) certificate() (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return nil, errors.New("no tls certificate configured")
+	}
+	return s.cert, nil
+}
+
+func (s *Store) pools() (*x509.CertPool, *x509.CertPool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ca, s.clientCA
+}
+
+// ServerConfig returns a server side configuration always using the latest
+// certificates. Client certificates are required when a client CA is set.
+// Everything is resolved per handshake rather than in a per-client config,
+// so that callers cloning the config, like grpc adding h2 to NextProtos,
+// keep their settings.
+func (s *Store) ServerConfig() *tls.Config {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.certificate()
+		},
+	}
+	if s.config.ClientCA == "" {
+		return c
+	}
+	// As on the client, the chain is verified against the current pool.
+	c.ClientAuth = tls.RequireAnyClientCert
+	c.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("client presented no certificate")
+		}
+		_, clientCA := s.pools()
+		opts := x509.VerifyOptions{
+			Roots:         clientCA,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return c
+}
+
+// ClientConfig returns a client side configuration always using the latest
+// certificates. Without a CA the server is verified against the system roots.
+func (s *Store) ClientConfig() *tls.Config {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: s.config.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert, err := s.certificate(); err == nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+	if s.config.CA == "" {
+		return c
+	}
+	// The CA may be rotated, so the chain is verified here against the
+	// current pool instead of a RootCAs fixed at dial time.
+	c.InsecureSkipVerify = true
+	c.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		ca, _ := s.pools()
+		opts := x509.VerifyOptions{
+			Roots:         ca,
+			DNSName:       state.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return c
+}
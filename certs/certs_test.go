@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newAuthority(t *testing.T) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &authority{cert: cert, key: key}
+}
+
+func (a *authority) writeCA(t *testing.T, path string) {
+	assert.Nil(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.cert.Raw}), 0600))
+}
+
+// issue writes a leaf certificate and its key signed by the authority.
+func (a *authority) issue(t *testing.T, dir, name string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	assert.Nil(t, err)
+	k, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	cert, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	assert.Nil(t, ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: k}), 0600))
+	return cert, keyFile
+}
+
+func handshake(t *testing.T, server, client *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	assert.Nil(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	c := tls.Client(conn, client)
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	// TLS 1.3 reports a rejected client certificate on the first read.
+	_, err = c.Read(make([]byte, 1))
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ca := newAuthority(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	ca.writeCA(t, caFile)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2)
+	clientCert, clientKey := ca.issue(t, dir, "agent", 3)
+
+	server, err := NewStore(Config{Cert: serverCert, Key: serverKey, ClientCA: caFile})
+	assert.Nil(t, err)
+	client, err := NewStore(Config{Cert: clientCert, Key: clientKey, CA: caFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+	assert.Nil(t, handshake(t, server.ServerConfig(), client.ClientConfig()))
+
+	anonymous, err := NewStore(Config{CA: caFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+	assert.NotNil(t, handshake(t, server.ServerConfig(), anonymous.ClientConfig()))
+
+	other := newAuthority(t)
+	otherFile := filepath.Join(dir, "other.crt")
+	other.writeCA(t, otherFile)
+	untrusted, err := NewStore(Config{Cert: clientCert, Key: clientKey, CA: otherFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+	assert.NotNil(t, handshake(t, server.ServerConfig(), untrusted.ClientConfig()))
+}
+
+func TestGrpc(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ca := newAuthority(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	ca.writeCA(t, caFile)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2)
+	clientCert, clientKey := ca.issue(t, dir, "agent", 3)
+	server, err := NewStore(Config{Cert: serverCert, Key: serverKey, ClientCA: caFile})
+	assert.Nil(t, err)
+	client, err := NewStore(Config{Cert: clientCert, Key: clientKey, CA: caFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(server.ServerConfig())))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(client.ClientConfig())))
+	assert.Nil(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var p peer.Peer
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+	assert.Nil(t, err)
+	// Clients from grpc 1.67 refuse servers not negotiating h2.
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	assert.True(t, ok)
+	assert.Equal(t, "h2", info.State.NegotiatedProtocol)
+}
+
+func TestReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ca := newAuthority(t)
+	cert, key := ca.issue(t, dir, "server", 2)
+
+	s, err := NewStore(Config{Cert: cert, Key: key})
+	assert.Nil(t, err)
+	assert.Nil(t, s.Reload())
+
+	ca.issue(t, dir, "server", 4)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(cert, later, later)
+	os.Chtimes(key, later, later)
+	assert.Nil(t, s.Reload())
+	c, err := s.certificate()
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), leaf.SerialNumber.Int64())
+
+	assert.Nil(t, ioutil.WriteFile(cert, []byte("broken"), 0600))
+	os.Chtimes(cert, later.Add(time.Minute), later.Add(time.Minute))
+	assert.NotNil(t, s.Reload())
+	c, err = s.certificate()
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestNewStore(t *testing.T) {
+	_, err := NewStore(Config{Cert: "server.crt"})
+	assert.NotNil(t, err)
+	assert.False(t, Config{}.Enabled())
+	assert.True(t, Config{CA: "ca.crt"}.Enabled())
+}
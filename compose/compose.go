@@ -0,0 +1,79 @@
+package compose
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
+)
+
+type service struct {
+	// DependsOn is either a list of services or a map keyed by service.
+	DependsOn interface{} `yaml:"depends_on"`
+	Links     []string    `yaml:"links"`
+}
+
+type file struct {
+	Services map[string]service `yaml:"services"`
+}
+
+func dependencies(s service) ([]string, error) {
+	var deps []string
+	switch d := s.DependsOn.(type) {
+	case nil:
+	case []interface{}:
+		for _, v := range d {
+			name, ok := v.(string)
+			if !ok {
+				return nil, errors.New("depends_on entries must be service names")
+			}
+			deps = append(deps, name)
+		}
+	case map[interface{}]interface{}:
+		for k := range d {
+			name, ok := k.(string)
+			if !ok {
+				return nil, errors.New("depends_on keys must be service names")
+			}
+			deps = append(deps, name)
+		}
+	default:
+		return nil, errors.New("depends_on must be a list or a map")
+	}
+	for _, l := range s.Links {
+		deps = append(deps, strings.SplitN(l, ":", 2)[0])
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// Parse turns a docker-compose file into the topology it is expected to
+// produce: a node per service and an edge per depends_on or links entry,
+// from the dependent service to its dependency.
+func Parse(b []byte, stack string) (*graph.Topology, error) {
+	var f file
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Services) == 0 {
+		return nil, errors.New("compose file has no services")
+	}
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	t := &graph.Topology{Nodes: make([]graph.Node, 0, len(names)), Edges: make([]graph.Edge, 0)}
+	for _, name := range names {
+		t.Nodes = append(t.Nodes, graph.Node{Id: name, Name: name, Service: name, Stack: stack})
+		deps, err := dependencies(f.Services[name])
+		if err != nil {
+			return nil, errors.New("service " + name + ": " + err.Error())
+		}
+		for _, dep := range deps {
+			t.Edges = append(t.Edges, graph.Edge{Src: name, Dst: dep})
+		}
+	}
+	return t, nil
+}
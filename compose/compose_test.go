@@ -0,0 +1,42 @@
+package compose
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t1, err := Parse([]byte(`
+version: "3.8"
+services:
+  web:
+    image: nginx
+    depends_on: [api]
+  api:
+    depends_on:
+      db:
+        condition: service_healthy
+    links:
+      - "cache:redis"
+  db: {}
+  cache: {}
+`), "shop")
+	assert.NoError(t, err)
+	assert.Len(t, t1.Nodes, 4)
+	assert.Equal(t, graph.Node{Id: "api", Name: "api", Service: "api", Stack: "shop"}, t1.Nodes[0])
+	assert.Equal(t, []graph.Edge{
+		{Src: "api", Dst: "cache"},
+		{Src: "api", Dst: "db"},
+		{Src: "web", Dst: "api"},
+	}, t1.Edges)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte("services: {}"), "shop")
+	assert.Error(t, err)
+	_, err = Parse([]byte("services:\n  api:\n    depends_on: db\n"), "shop")
+	assert.Error(t, err)
+	_, err = Parse([]byte("{nope"), "shop")
+	assert.Error(t, err)
+}
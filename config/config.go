@@ -0,0 +1,73 @@
+package config
+
+import (
+	"docker-visualizer/aggregator/anomaly"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/certs"
+	"docker-visualizer/aggregator/cors"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/operations"
+	"docker-visualizer/aggregator/policy"
+	"docker-visualizer/aggregator/queue"
+	"docker-visualizer/aggregator/ratelimit"
+	"docker-visualizer/aggregator/sink"
+	"docker-visualizer/aggregator/tracing"
+	"docker-visualizer/aggregator/traffic"
+	"docker-visualizer/aggregator/utils"
+	"docker-visualizer/aggregator/webhook"
+	"encoding/json"
+	"io/ioutil"
+)
+
+type Config struct {
+	Backend   utils.BackendConfig     `json:"backend"`
+	GrpcTLS   certs.Config            `json:"grpc_tls"`
+	Auth      auth.Config             `json:"auth"`
+	Agents    []auth.Agent            `json:"agents"`
+	Cors      cors.Config             `json:"cors"`
+	RateLimit ratelimit.Config        `json:"rate_limit"`
+	Webhooks  webhook.Config          `json:"webhooks"`
+	Sink      sink.Config             `json:"sink"`
+	Queue     queue.Config            `json:"queue"`
+	Logging   logging.Config          `json:"logging"`
+	Tracing   tracing.Config          `json:"tracing"`
+	Policy    policy.Config           `json:"policy"`
+	Anomaly   anomaly.Config          `json:"anomaly"`
+	Traffic   traffic.Config          `json:"traffic"`
+	Edges     operations.ExpiryConfig `json:"edges"`
+}
+
+func Default() *Config {
+	return &Config{
+		Backend:   utils.DefaultBackendConfig(),
+		GrpcTLS:   certs.DefaultConfig(),
+		Cors:      cors.DefaultConfig(),
+		RateLimit: ratelimit.DefaultConfig(),
+		Webhooks:  webhook.DefaultConfig(),
+		Sink:      sink.DefaultConfig(),
+		Queue:     queue.DefaultConfig(),
+		Logging:   logging.DefaultConfig(),
+		Tracing:   tracing.DefaultConfig(),
+		Policy:    policy.DefaultConfig(),
+		Anomaly:   anomaly.DefaultConfig(),
+		Traffic:   traffic.DefaultConfig(),
+		Edges:     operations.DefaultExpiryConfig(),
+	}
+}
+
+// Load reads a JSON configuration file on top of the defaults.
+// An empty path returns the defaults.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
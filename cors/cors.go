@@ -0,0 +1,112 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ALL_ORIGINS = "*"
+)
+
+type Config struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age_s"`
+}
+
+// Cors answers preflight requests and adds the CORS headers to the responses
+// of allowed origins. Requests without an Origin header are left untouched.
+type Cors struct {
+	config  Config
+	origins map[string]bool
+	any     bool
+	methods string
+	headers string
+	exposed string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AllowedOrigins: []string{ALL_ORIGINS},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         600,
+	}
+}
+
+// New refuses credentials with ALL_ORIGINS: any website could then read the
+// responses of authenticated users.
+func New(c Config) (*Cors, error) {
+	cors := &Cors{
+		config:  c,
+		origins: make(map[string]bool),
+		methods: strings.Join(c.AllowedMethods, ", "),
+		headers: strings.Join(c.AllowedHeaders, ", "),
+		exposed: strings.Join(c.ExposedHeaders, ", "),
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == ALL_ORIGINS {
+			cors.any = true
+		}
+		cors.origins[strings.ToLower(o)] = true
+	}
+	if cors.any && c.AllowCredentials {
+		return nil, errors.New("cors credentials cannot be allowed for all origins")
+	}
+	return cors, nil
+}
+
+func (c *Cors) allowed(origin string) bool {
+	return c.any || c.origins[strings.ToLower(origin)]
+}
+
+func (c *Cors) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !c.allowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if c.any {
+			w.Header().Set("Access-Control-Allow-Origin", ALL_ORIGINS)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if c.exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", c.exposed)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		if c.headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		}
+		if c.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.config.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
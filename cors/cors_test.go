@@ -0,0 +1,69 @@
+package cors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func serve(c *Cors, method, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/topology/front", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	w := httptest.NewRecorder()
+	c.Handler(ok).ServeHTTP(w, req)
+	return w
+}
+
+func TestWildcard(t *testing.T) {
+	c, _ := New(DefaultConfig())
+
+	w := serve(c, http.MethodGet, "")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(c, http.MethodGet, "http://ui.local")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestPreflight(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedOrigins = []string{"http://ui.local"}
+	config.AllowCredentials = true
+	c, err := New(config)
+	assert.Nil(t, err)
+
+	w := serve(c, http.MethodOptions, "http://ui.local")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "http://ui.local", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	w = serve(c, http.MethodOptions, "http://evil.local")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(c, http.MethodGet, "http://evil.local")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCredentialsWithAllOrigins(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowCredentials = true
+	_, err := New(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/utils"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+const (
+	CYCLES_OK    = 0
+	CYCLES_NEW   = 1
+	CYCLES_ERROR = 2
+)
+
+var (
+	checkCycles    = flag.Bool("check-cycles", false, "report the dependency cycles of the topology and exit, non-zero when cycles are not in the baseline")
+	cyclesStack    = flag.String("stack", "", "stack checked by -check-cycles, the whole cluster when empty")
+	cyclesBaseline = flag.String("cycles-baseline", "", "JSON file listing the known cycles for -check-cycles")
+	updateBaseline = flag.Bool("update-baseline", false, "write the cycles found by -check-cycles to the baseline")
+)
+
+func readBaseline(path string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	if path == "" {
+		return known, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		known[k] = true
+	}
+	return known, nil
+}
+
+func writeBaseline(path string, components []graph.Component) error {
+	keys := make([]string, 0, len(components))
+	for _, c := range components {
+		keys = append(keys, c.Key())
+	}
+	sort.Strings(keys)
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// runCyclesCheck prints the cycles of the topology missing from the baseline
+// and returns the process exit code.
+func runCyclesCheck(g graph.IGraph, stack, baseline string, update bool) int {
+	known, err := readBaseline(baseline)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot read cycles baseline:", err)
+		return CYCLES_ERROR
+	}
+	t, err := g.FindTopology(stack)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot compute cycles:", err)
+		return CYCLES_ERROR
+	}
+	components := t.Components(stack)
+	if update {
+		if baseline == "" {
+			fmt.Fprintln(os.Stderr, "-update-baseline needs -cycles-baseline")
+			return CYCLES_ERROR
+		}
+		if err := writeBaseline(baseline, components); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot write cycles baseline:", err)
+			return CYCLES_ERROR
+		}
+		return CYCLES_OK
+	}
+	code := CYCLES_OK
+	for _, c := range components {
+		if known[c.Key()] {
+			continue
+		}
+		code = CYCLES_NEW
+		fmt.Printf("new cycle %s: %v\n", c.Key(), c.Cycle)
+	}
+	return code
+}
+
+func cyclesCheck(c utils.BackendConfig) int {
+	conn := utils.SetupGrpcConnection(c)
+	defer conn.Close()
+	return runCyclesCheck(graph.NewGraphClient(conn), *cyclesStack, *cyclesBaseline, *updateBaseline)
+}
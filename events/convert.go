@@ -0,0 +1,44 @@
+package events
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+)
+
+// busEventTypes maps every bus.Types entry.
+var busEventTypes = map[bus.EventType]EventType{
+	bus.NODE_ADDED:          EventType_NODE_ADDED,
+	bus.NODE_REMOVED:        EventType_NODE_REMOVED,
+	bus.NODE_UPDATED:        EventType_NODE_UPDATED,
+	bus.CONNECTION_OBSERVED: EventType_CONNECTION_OBSERVED,
+	bus.EDGE_ADDED:          EventType_EDGE_ADDED,
+	bus.EDGE_EXPIRED:        EventType_EDGE_REMOVED,
+	bus.VIOLATION:           EventType_VIOLATION,
+	bus.ANOMALY:             EventType_ANOMALY,
+}
+
+func NewNode(n *graph.Node) *Node {
+	if n == nil {
+		return nil
+	}
+	return &Node{
+		Id:      n.Id,
+		Name:    n.Name,
+		Ip:      n.Ip,
+		Stack:   n.Stack,
+		Network: n.Network,
+		Service: n.Service,
+		Host:    n.Host,
+	}
+}
+
+// NewTopologyEvent converts a bus event into its protobuf representation.
+func NewTopologyEvent(e bus.Event) *TopologyEvent {
+	event := &TopologyEvent{Type: busEventTypes[e.Type], Reason: e.Reason}
+	if c := e.Connection; c != nil {
+		event.Edge = &Edge{Source: c.Src, Destination: c.Dst, Size: c.Size}
+	} else {
+		event.Node = NewNode(e.Node)
+	}
+	return event
+}
@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"errors"
+	"sort"
+)
+
+// View is an attribute the containers of a topology are grouped by.
+type View string
+
+const (
+	SERVICE_VIEW View = "service"
+	HOST_VIEW    View = "host"
+	NETWORK_VIEW View = "network"
+)
+
+var ErrUnknownView = errors.New("unknown topology view")
+
+// Group is the set of containers sharing the attribute of a view.
+type Group struct {
+	Key   string   `json:"key"`
+	Nodes []string `json:"nodes"`
+}
+
+// Link merges the edges between the containers of two groups. Pairs counts
+// the container edges behind it.
+type Link struct {
+	Src     string `json:"source"`
+	Dst     string `json:"destination"`
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	Pairs   int    `json:"pairs"`
+}
+
+type Aggregate struct {
+	View   View    `json:"view"`
+	Groups []Group `json:"groups"`
+	Links  []Link  `json:"links"`
+}
+
+func (v View) key(n *Node) (string, error) {
+	switch v {
+	case SERVICE_VIEW:
+		// Services are named within their stack.
+		return n.Stack + "/" + serviceName(n), nil
+	case HOST_VIEW:
+		return n.Host, nil
+	case NETWORK_VIEW:
+		return n.Network, nil
+	}
+	return "", ErrUnknownView
+}
+
+// Aggregate collapses the nodes of the topology into groups and their
+// edges into links. Edges leaving the topology's nodes are left out.
+func (t *Topology) Aggregate(v View) (*Aggregate, error) {
+	groups := make(map[string]*Group)
+	keys := make(map[string]string, len(t.Nodes))
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		k, err := v.key(n)
+		if err != nil {
+			return nil, err
+		}
+		keys[n.Id] = k
+		g, ok := groups[k]
+		if !ok {
+			g = &Group{Key: k}
+			groups[k] = g
+		}
+		g.Nodes = append(g.Nodes, n.Id)
+	}
+	links := make(map[[2]string]*Link)
+	for _, e := range t.Edges {
+		src, ok := keys[e.Src]
+		if !ok {
+			continue
+		}
+		dst, ok := keys[e.Dst]
+		if !ok {
+			continue
+		}
+		l, ok := links[[2]string{src, dst}]
+		if !ok {
+			l = &Link{Src: src, Dst: dst}
+			links[[2]string{src, dst}] = l
+		}
+		l.Bytes += e.Bytes
+		l.Packets += e.Packets
+		l.Pairs++
+	}
+
+	a := &Aggregate{View: v, Groups: make([]Group, 0, len(groups)), Links: make([]Link, 0, len(links))}
+	for _, g := range groups {
+		sort.Strings(g.Nodes)
+		a.Groups = append(a.Groups, *g)
+	}
+	sort.Slice(a.Groups, func(i, j int) bool { return a.Groups[i].Key < a.Groups[j].Key })
+	for _, l := range links {
+		a.Links = append(a.Links, *l)
+	}
+	sort.Slice(a.Links, func(i, j int) bool {
+		if a.Links[i].Src != a.Links[j].Src {
+			return a.Links[i].Src < a.Links[j].Src
+		}
+		return a.Links[i].Dst < a.Links[j].Dst
+	})
+	return a, nil
+}
@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func aggregateTopology() *Topology {
+	return &Topology{
+		Nodes: []Node{
+			{Id: "front-1", Stack: "web", Service: "front", Host: "h1", Network: "public"},
+			{Id: "front-2", Stack: "web", Service: "front", Host: "h2", Network: "public"},
+			{Id: "api-1", Stack: "web", Service: "api", Host: "h1", Network: "back"},
+			{Id: "api-2", Stack: "web", Service: "api", Host: "h2", Network: "back"},
+		},
+		Edges: []Edge{
+			{Src: "front-1", Dst: "api-1", Bytes: 10, Packets: 1},
+			{Src: "front-1", Dst: "api-2", Bytes: 20, Packets: 2},
+			{Src: "front-2", Dst: "api-2", Bytes: 30, Packets: 3},
+			{Src: "api-1", Dst: "api-2", Bytes: 5, Packets: 1},
+			{Src: "api-2", Dst: "elsewhere"},
+		},
+	}
+}
+
+func TestAggregateService(t *testing.T) {
+	a, err := aggregateTopology().Aggregate(SERVICE_VIEW)
+	assert.Nil(t, err)
+	assert.Equal(t, []Group{
+		{Key: "web/api", Nodes: []string{"api-1", "api-2"}},
+		{Key: "web/front", Nodes: []string{"front-1", "front-2"}},
+	}, a.Groups)
+	assert.Equal(t, []Link{
+		{Src: "web/api", Dst: "web/api", Bytes: 5, Packets: 1, Pairs: 1},
+		{Src: "web/front", Dst: "web/api", Bytes: 60, Packets: 6, Pairs: 3},
+	}, a.Links)
+}
+
+func TestAggregateServiceStandalone(t *testing.T) {
+	topology := &Topology{
+		Nodes: []Node{
+			{Id: "1", Stack: "web", Name: "cache"},
+			{Id: "2", Stack: "web", Name: "queue"},
+		},
+		Edges: []Edge{{Src: "1", Dst: "2", Bytes: 10, Packets: 1}},
+	}
+	a, err := topology.Aggregate(SERVICE_VIEW)
+	assert.Nil(t, err)
+	assert.Equal(t, []Group{
+		{Key: "web/cache", Nodes: []string{"1"}},
+		{Key: "web/queue", Nodes: []string{"2"}},
+	}, a.Groups)
+	assert.Equal(t, []Link{{Src: "web/cache", Dst: "web/queue", Bytes: 10, Packets: 1, Pairs: 1}}, a.Links)
+}
+
+func TestAggregateHost(t *testing.T) {
+	a, err := aggregateTopology().Aggregate(HOST_VIEW)
+	assert.Nil(t, err)
+	assert.Len(t, a.Groups, 2)
+	assert.Equal(t, []Link{
+		{Src: "h1", Dst: "h1", Bytes: 10, Packets: 1, Pairs: 1},
+		{Src: "h1", Dst: "h2", Bytes: 25, Packets: 3, Pairs: 2},
+		{Src: "h2", Dst: "h2", Bytes: 30, Packets: 3, Pairs: 1},
+	}, a.Links)
+}
+
+func TestAggregateUnknownView(t *testing.T) {
+	_, err := aggregateTopology().Aggregate("pod")
+	assert.Equal(t, ErrUnknownView, err)
+}
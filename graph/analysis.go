@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"errors"
+	"sort"
+)
+
+// Direction tells which edges a traversal follows. An edge goes from the
+// container opening the connection to the one it depends on.
+type Direction int
+
+const (
+	// Downstream follows edges from source to destination: dependencies.
+	Downstream Direction = iota
+	// Upstream follows edges from destination to source: dependents.
+	Upstream
+)
+
+var ErrNodeNotFound = errors.New("node not found")
+
+// Reached is a node found by a traversal, with its distance to the origin
+// and the ids of a shortest path leading to it, origin and node included.
+type Reached struct {
+	Node  Node     `json:"node"`
+	Depth int      `json:"depth"`
+	Path  []string `json:"path"`
+}
+
+type Closure struct {
+	Origin Node      `json:"origin"`
+	Nodes  []Reached `json:"nodes"`
+}
+
+// ImpactedService is a service losing a dependency when the origin dies.
+// Direct services call the origin themselves; the others depend on it
+// through Depth hops.
+type ImpactedService struct {
+	Stack   string   `json:"stack"`
+	Service string   `json:"service"`
+	Nodes   []string `json:"nodes"`
+	Depth   int      `json:"depth"`
+	Direct  bool     `json:"direct"`
+}
+
+type BlastRadius struct {
+	Origin   Node              `json:"origin"`
+	Services []ImpactedService `json:"services"`
+}
+
+type adjacency map[string][]string
+
+func (t *Topology) adjacency(d Direction) adjacency {
+	a := make(adjacency)
+	for _, e := range t.Edges {
+		if d == Downstream {
+			a[e.Src] = append(a[e.Src], e.Dst)
+		} else {
+			a[e.Dst] = append(a[e.Dst], e.Src)
+		}
+	}
+	return a
+}
+
+func (t *Topology) index() map[string]*Node {
+	nodes := make(map[string]*Node, len(t.Nodes))
+	for i := range t.Nodes {
+		nodes[t.Nodes[i].Id] = &t.Nodes[i]
+	}
+	return nodes
+}
+
+// Closure returns the nodes reachable from id in the given direction, in
+// breadth first order. A positive maxDepth stops the traversal that far.
+func (t *Topology) Closure(id string, d Direction, maxDepth int) (*Closure, error) {
+	nodes := t.index()
+	origin, ok := nodes[id]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	next := t.adjacency(d)
+	c := &Closure{Origin: *origin, Nodes: make([]Reached, 0)}
+	paths := map[string][]string{id: {id}}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		depth := len(paths[current]) - 1
+		if maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+		for _, n := range next[current] {
+			if _, seen := paths[n]; seen {
+				continue
+			}
+			path := make([]string, depth+2)
+			copy(path, paths[current])
+			path[depth+1] = n
+			paths[n] = path
+			queue = append(queue, n)
+			reached := Reached{Node: Node{Id: n}, Depth: depth + 1, Path: path}
+			if node, ok := nodes[n]; ok {
+				reached.Node = *node
+			}
+			c.Nodes = append(c.Nodes, reached)
+		}
+	}
+	return c, nil
+}
+
+// BlastRadius groups the transitive dependents of id by stack and service,
+// closest services first.
+func (t *Topology) BlastRadius(id string, maxDepth int) (*BlastRadius, error) {
+	c, err := t.Closure(id, Upstream, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ stack, service string }
+	services := make(map[key]*ImpactedService)
+	for _, r := range c.Nodes {
+		k := key{r.Node.Stack, r.Node.Service}
+		s, ok := services[k]
+		if !ok {
+			s = &ImpactedService{Stack: k.stack, Service: k.service, Depth: r.Depth}
+			services[k] = s
+		}
+		s.Nodes = append(s.Nodes, r.Node.Id)
+		if r.Depth < s.Depth {
+			s.Depth = r.Depth
+		}
+		s.Direct = s.Depth == 1
+	}
+	b := &BlastRadius{Origin: c.Origin, Services: make([]ImpactedService, 0, len(services))}
+	for _, s := range services {
+		b.Services = append(b.Services, *s)
+	}
+	sort.Slice(b.Services, func(i, j int) bool {
+		a, o := b.Services[i], b.Services[j]
+		if a.Depth != o.Depth {
+			return a.Depth < o.Depth
+		}
+		if a.Stack != o.Stack {
+			return a.Stack < o.Stack
+		}
+		return a.Service < o.Service
+	})
+	return b, nil
+}
@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// front -> api -> db, api -> cache, worker -> db, db-2 is a replica of db.
+func analysisTopology() *Topology {
+	return &Topology{
+		Nodes: []Node{
+			{Id: "front", Stack: "web", Service: "front"},
+			{Id: "api", Stack: "web", Service: "api"},
+			{Id: "db", Stack: "data", Service: "db"},
+			{Id: "db-2", Stack: "data", Service: "db"},
+			{Id: "cache", Stack: "data", Service: "cache"},
+			{Id: "worker", Stack: "jobs", Service: "worker"},
+		},
+		Edges: []Edge{
+			{Src: "front", Dst: "api"},
+			{Src: "api", Dst: "db"},
+			{Src: "api", Dst: "cache"},
+			{Src: "worker", Dst: "db"},
+			{Src: "db-2", Dst: "db"},
+			{Src: "db", Dst: "api"},
+		},
+	}
+}
+
+func ids(c *Closure) map[string]int {
+	r := make(map[string]int)
+	for _, n := range c.Nodes {
+		r[n.Node.Id] = n.Depth
+	}
+	return r
+}
+
+func TestClosureDownstream(t *testing.T) {
+	c, err := analysisTopology().Closure("front", Downstream, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "front", c.Origin.Id)
+	assert.Equal(t, map[string]int{"api": 1, "db": 2, "cache": 2}, ids(c))
+	for _, n := range c.Nodes {
+		if n.Node.Id == "db" {
+			assert.Equal(t, []string{"front", "api", "db"}, n.Path)
+			assert.Equal(t, "data", n.Node.Stack)
+		}
+	}
+}
+
+func TestClosureUpstream(t *testing.T) {
+	c, err := analysisTopology().Closure("db", Upstream, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"api": 1, "worker": 1, "db-2": 1, "front": 2}, ids(c))
+}
+
+func TestClosureDepth(t *testing.T) {
+	c, err := analysisTopology().Closure("front", Downstream, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"api": 1}, ids(c))
+}
+
+func TestClosureUnknownNode(t *testing.T) {
+	_, err := analysisTopology().Closure("nope", Downstream, 0)
+	assert.Equal(t, ErrNodeNotFound, err)
+}
+
+func TestBlastRadius(t *testing.T) {
+	b, err := analysisTopology().BlastRadius("cache", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []ImpactedService{
+		{Stack: "web", Service: "api", Nodes: []string{"api"}, Depth: 1, Direct: true},
+		{Stack: "data", Service: "db", Nodes: []string{"db", "db-2"}, Depth: 2},
+		{Stack: "web", Service: "front", Nodes: []string{"front"}, Depth: 2},
+		{Stack: "jobs", Service: "worker", Nodes: []string{"worker"}, Depth: 3},
+	}, b.Services)
+}
@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ServiceEdge is an edge between two services, named as in Diff.
+type ServiceEdge struct {
+	Src string `json:"source"`
+	Dst string `json:"destination"`
+}
+
+// Diff lists how a topology departs from an expected one. Containers are
+// matched on their service, or their name when they have none, since ids
+// change at every deployment.
+type Diff struct {
+	Match             bool          `json:"match"`
+	UnexpectedEdges   []ServiceEdge `json:"unexpected_edges"`
+	MissingEdges      []ServiceEdge `json:"missing_edges"`
+	UnknownContainers []Node        `json:"unknown_containers"`
+	AbsentContainers  []string      `json:"absent_containers"`
+}
+
+func serviceName(n *Node) string {
+	if n.Service != "" {
+		return n.Service
+	}
+	return n.Name
+}
+
+// services maps the ids of the nodes to their service names and lists the
+// service edges between them. Edges to unknown nodes are left out.
+func (t *Topology) services() (map[string]string, map[ServiceEdge]bool) {
+	names := make(map[string]string, len(t.Nodes))
+	for i := range t.Nodes {
+		names[t.Nodes[i].Id] = serviceName(&t.Nodes[i])
+	}
+	edges := make(map[ServiceEdge]bool)
+	for _, e := range t.Edges {
+		src, ok := names[e.Src]
+		if !ok {
+			continue
+		}
+		dst, ok := names[e.Dst]
+		if !ok {
+			continue
+		}
+		edges[ServiceEdge{Src: src, Dst: dst}] = true
+	}
+	return names, edges
+}
+
+func sortEdges(edges []ServiceEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Src != edges[j].Src {
+			return edges[i].Src < edges[j].Src
+		}
+		return edges[i].Dst < edges[j].Dst
+	})
+}
+
+// Compare diffs the topology against the expected one.
+func (t *Topology) Compare(expected *Topology) *Diff {
+	names, edges := t.services()
+	expectedNames, expectedEdges := expected.services()
+	d := &Diff{
+		UnexpectedEdges:   make([]ServiceEdge, 0),
+		MissingEdges:      make([]ServiceEdge, 0),
+		UnknownContainers: make([]Node, 0),
+		AbsentContainers:  make([]string, 0),
+	}
+
+	known := make(map[string]bool, len(expectedNames))
+	for _, name := range expectedNames {
+		known[name] = true
+	}
+	present := make(map[string]bool, len(names))
+	for _, n := range t.Nodes {
+		present[serviceName(&n)] = true
+		if !known[serviceName(&n)] {
+			d.UnknownContainers = append(d.UnknownContainers, n)
+		}
+	}
+	for name := range known {
+		if !present[name] {
+			d.AbsentContainers = append(d.AbsentContainers, name)
+		}
+	}
+	for e := range edges {
+		if !expectedEdges[e] {
+			d.UnexpectedEdges = append(d.UnexpectedEdges, e)
+		}
+	}
+	for e := range expectedEdges {
+		if !edges[e] {
+			d.MissingEdges = append(d.MissingEdges, e)
+		}
+	}
+
+	sort.Slice(d.UnknownContainers, func(i, j int) bool { return d.UnknownContainers[i].Id < d.UnknownContainers[j].Id })
+	sort.Strings(d.AbsentContainers)
+	sortEdges(d.UnexpectedEdges)
+	sortEdges(d.MissingEdges)
+	d.Match = len(d.UnexpectedEdges) == 0 && len(d.MissingEdges) == 0 &&
+		len(d.UnknownContainers) == 0 && len(d.AbsentContainers) == 0
+	return d
+}
+
+// exported is a node of the FindByStack JSON, nesting the nodes it is
+// connected to and the ones connected to it.
+type exported struct {
+	Node
+	Uid       string     `json:"uid"`
+	Connected []exported `json:"connected"`
+	Parent    []exported `json:"parent"`
+}
+
+// ParseExport reads a stack as returned by FindByStack back into the
+// topology FindTopology returns for it: the nodes of the stack and their
+// edges. Peers are matched on their uid since nested nodes may only carry it.
+func ParseExport(b []byte, stack string) (*Topology, error) {
+	var root struct {
+		Find []exported `json:"find"`
+	}
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	if root.Find == nil {
+		return nil, errors.New("not a topology export")
+	}
+	t := &Topology{Nodes: make([]Node, 0), Edges: make([]Edge, 0)}
+	ids := make(map[string]string)
+	var edges [][2]string
+	var walk func(e *exported)
+	walk = func(e *exported) {
+		if e.Id != "" && ids[e.Uid] == "" {
+			ids[e.Uid] = e.Id
+			if e.Stack == stack {
+				t.Nodes = append(t.Nodes, e.Node)
+			}
+		}
+		for i := range e.Connected {
+			edges = append(edges, [2]string{e.Uid, e.Connected[i].Uid})
+			walk(&e.Connected[i])
+		}
+		for i := range e.Parent {
+			edges = append(edges, [2]string{e.Parent[i].Uid, e.Uid})
+			walk(&e.Parent[i])
+		}
+	}
+	for i := range root.Find {
+		walk(&root.Find[i])
+	}
+	seen := make(map[[2]string]bool)
+	for _, e := range edges {
+		k := [2]string{ids[e[0]], ids[e[1]]}
+		if k[0] == "" || k[1] == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		t.Edges = append(t.Edges, Edge{Src: k[0], Dst: k[1]})
+	}
+	return t, nil
+}
@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompareMatch(t *testing.T) {
+	actual := &Topology{
+		Nodes: []Node{
+			{Id: "a1", Service: "api"},
+			{Id: "a2", Service: "api"},
+			{Id: "d", Name: "db"},
+		},
+		Edges: []Edge{{Src: "a1", Dst: "d"}, {Src: "a2", Dst: "d"}, {Src: "d", Dst: "outside"}},
+	}
+	expected := &Topology{
+		Nodes: []Node{{Id: "api", Service: "api"}, {Id: "db", Service: "db"}},
+		Edges: []Edge{{Src: "api", Dst: "db"}},
+	}
+	d := actual.Compare(expected)
+	assert.True(t, d.Match)
+	assert.Empty(t, d.UnexpectedEdges)
+	assert.Empty(t, d.AbsentContainers)
+}
+
+func TestCompareDiff(t *testing.T) {
+	actual := &Topology{
+		Nodes: []Node{{Id: "a", Service: "api"}, {Id: "m", Service: "miner"}},
+		Edges: []Edge{{Src: "a", Dst: "m"}},
+	}
+	expected := &Topology{
+		Nodes: []Node{{Id: "api", Service: "api"}, {Id: "db", Service: "db"}},
+		Edges: []Edge{{Src: "api", Dst: "db"}},
+	}
+	d := actual.Compare(expected)
+	assert.False(t, d.Match)
+	assert.Equal(t, []ServiceEdge{{Src: "api", Dst: "miner"}}, d.UnexpectedEdges)
+	assert.Equal(t, []ServiceEdge{{Src: "api", Dst: "db"}}, d.MissingEdges)
+	assert.Equal(t, []Node{{Id: "m", Service: "miner"}}, d.UnknownContainers)
+	assert.Equal(t, []string{"db"}, d.AbsentContainers)
+}
+
+func TestParseExport(t *testing.T) {
+	export := `{"find":[
+		{"uid":"0x1","id":"a","name":"api_1","stack":"web","service":"api","connected":[
+			{"uid":"0x2","id":"b","stack":"web","service":"db","parent":[{"uid":"0x1"}]},
+			{"uid":"0x9","id":"z","stack":"shared","service":"auth"}
+		]},
+		{"uid":"0x2","id":"b","stack":"web","service":"db","parent":[{"uid":"0x1","id":"a"}]}
+	]}`
+	topology, err := ParseExport([]byte(export), "web")
+	assert.Nil(t, err)
+	assert.Equal(t, []Node{
+		{Id: "a", Name: "api_1", Stack: "web", Service: "api"},
+		{Id: "b", Stack: "web", Service: "db"},
+	}, topology.Nodes)
+	assert.Equal(t, []Edge{{Src: "a", Dst: "b"}, {Src: "a", Dst: "z"}}, topology.Edges)
+
+	_, err = ParseExport([]byte(`{"nodes":[]}`), "web")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,19 @@
+package graph
+
+import (
+	"context"
+)
+
+// ContextBinder is implemented by graphs able to attach their calls to the
+// request they serve, for instance to trace them.
+type ContextBinder interface {
+	WithContext(ctx context.Context) IGraph
+}
+
+// WithContext binds g to ctx when it supports it, and returns g otherwise.
+func WithContext(g IGraph, ctx context.Context) IGraph {
+	if b, ok := g.(ContextBinder); ok {
+		return b.WithContext(ctx)
+	}
+	return g
+}
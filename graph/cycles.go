@@ -0,0 +1,170 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+)
+
+// Component is a strongly connected component of the topology: every node
+// in it can reach every other one, so it holds at least one cycle.
+type Component struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// Cycle is a shortest cycle through the first node, closed on itself.
+	Cycle []string `json:"cycle"`
+}
+
+// Key identifies a component by the services in it rather than by their
+// containers, so that it survives redeployments.
+func (c Component) Key() string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, len(c.Nodes))
+	for _, n := range c.Nodes {
+		k := n.Stack + "/" + n.Service
+		if n.Service == "" {
+			k = n.Stack + "/" + n.Name
+		}
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Components returns the strongly connected components holding a cycle,
+// using Tarjan's algorithm. With a non empty stack, only the edges between
+// containers of that stack are considered.
+func (t *Topology) Components(stack string) []Component {
+	index := t.index()
+	inside := func(id string) bool {
+		n, ok := index[id]
+		return ok && (stack == "" || n.Stack == stack)
+	}
+	next := make(adjacency)
+	var edges []Edge
+	for _, e := range t.Edges {
+		if inside(e.Src) && inside(e.Dst) {
+			next[e.Src] = append(next[e.Src], e.Dst)
+			edges = append(edges, e)
+		}
+	}
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		if inside(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, n := range next {
+		sort.Strings(n)
+	}
+
+	s := &tarjan{next: next, index: make(map[string]int), low: make(map[string]int), onStack: make(map[string]bool)}
+	for _, id := range ids {
+		if _, ok := s.index[id]; !ok {
+			s.visit(id)
+		}
+	}
+
+	components := make([]Component, 0)
+	for _, scc := range s.components {
+		members := make(map[string]bool, len(scc))
+		for _, id := range scc {
+			members[id] = true
+		}
+		c := Component{}
+		for _, e := range edges {
+			if members[e.Src] && members[e.Dst] {
+				c.Edges = append(c.Edges, e)
+			}
+		}
+		if len(scc) == 1 && len(c.Edges) == 0 {
+			continue
+		}
+		sort.Strings(scc)
+		for _, id := range scc {
+			c.Nodes = append(c.Nodes, *index[id])
+		}
+		c.Cycle = next.cycle(scc[0], members)
+		components = append(components, c)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Nodes[0].Id < components[j].Nodes[0].Id
+	})
+	return components
+}
+
+type tarjan struct {
+	next       adjacency
+	counter    int
+	index      map[string]int
+	low        map[string]int
+	stack      []string
+	onStack    map[string]bool
+	components [][]string
+}
+
+func (s *tarjan) visit(id string) {
+	s.index[id] = s.counter
+	s.low[id] = s.counter
+	s.counter++
+	s.stack = append(s.stack, id)
+	s.onStack[id] = true
+	for _, n := range s.next[id] {
+		if _, ok := s.index[n]; !ok {
+			s.visit(n)
+			if s.low[n] < s.low[id] {
+				s.low[id] = s.low[n]
+			}
+		} else if s.onStack[n] && s.index[n] < s.low[id] {
+			s.low[id] = s.index[n]
+		}
+	}
+	if s.low[id] != s.index[id] {
+		return
+	}
+	var scc []string
+	for {
+		n := s.stack[len(s.stack)-1]
+		s.stack = s.stack[:len(s.stack)-1]
+		s.onStack[n] = false
+		scc = append(scc, n)
+		if n == id {
+			break
+		}
+	}
+	s.components = append(s.components, scc)
+}
+
+// cycle finds a shortest way back to id within the members of its component.
+func (a adjacency) cycle(id string, members map[string]bool) []string {
+	prev := make(map[string]string)
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, n := range a[current] {
+			if !members[n] {
+				continue
+			}
+			if n == id {
+				path := []string{id}
+				for c := current; c != id; c = prev[c] {
+					path = append(path, c)
+				}
+				path = append(path, id)
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			if _, seen := prev[n]; !seen {
+				prev[n] = current
+				queue = append(queue, n)
+			}
+		}
+	}
+	return nil
+}
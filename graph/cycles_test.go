@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// a <-> b within web, c -> d -> e -> c across web and data, f calls itself.
+func cyclesTopology() *Topology {
+	return &Topology{
+		Nodes: []Node{
+			{Id: "a", Stack: "web", Service: "front"},
+			{Id: "b", Stack: "web", Service: "api"},
+			{Id: "c", Stack: "web", Service: "api"},
+			{Id: "d", Stack: "data", Service: "db"},
+			{Id: "e", Stack: "web", Service: "cache"},
+			{Id: "f", Stack: "jobs", Service: "worker"},
+			{Id: "g", Stack: "jobs", Service: "cron"},
+		},
+		Edges: []Edge{
+			{Src: "a", Dst: "b"},
+			{Src: "b", Dst: "a"},
+			{Src: "c", Dst: "d"},
+			{Src: "d", Dst: "e"},
+			{Src: "e", Dst: "c"},
+			{Src: "f", Dst: "f"},
+			{Src: "g", Dst: "f"},
+			{Src: "b", Dst: "c"},
+		},
+	}
+}
+
+func TestComponentsCluster(t *testing.T) {
+	c := cyclesTopology().Components("")
+	assert.Len(t, c, 3)
+	assert.Equal(t, []string{"a", "b", "a"}, c[0].Cycle)
+	assert.Len(t, c[0].Edges, 2)
+	assert.Equal(t, []string{"c", "d", "e", "c"}, c[1].Cycle)
+	assert.Equal(t, "data/db,web/api,web/cache", c[1].Key())
+	assert.Equal(t, []string{"f", "f"}, c[2].Cycle)
+}
+
+func TestComponentsStack(t *testing.T) {
+	c := cyclesTopology().Components("web")
+	assert.Len(t, c, 1)
+	assert.Equal(t, "web/api,web/front", c[0].Key())
+	assert.Empty(t, cyclesTopology().Components("data"))
+}
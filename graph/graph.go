@@ -2,45 +2,87 @@ package graph
 
 import (
 	"context"
+	"docker-visualizer/aggregator/logging"
 	pb "docker-visualizer/proto/containers"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/dgraph-io/dgraph/client"
 	"github.com/dgraph-io/dgraph/protos/api"
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"strings"
+	"time"
 )
 
+var log = logging.For("graph")
+
 type GraphClient struct {
 	cli *client.Dgraph
 }
 
 type Connection struct {
-	Src  string `json:"source"`
-	Dst  string `json:"destination"`
-	Size uint32 `json:"size"`
+	Src   string `json:"source"`
+	Dst   string `json:"destination"`
+	Size  uint32 `json:"size"`
+	Agent string `json:"agent,omitempty"`
+	// Violation is the policy rule the connection violates, if any.
+	Violation string `json:"violation,omitempty"`
+	SrcNode   *Node  `json:"-"`
+	DstNode   *Node  `json:"-"`
+	// New is set when the connection created the edge.
+	New bool `json:"-"`
+}
+
+type Node struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Ip      string `json:"ip"`
+	Stack   string `json:"stack"`
+	Network string `json:"network"`
+	Service string `json:"service"`
+	Host    string `json:"host"`
+	Agent   string `json:"agent,omitempty"`
+}
+
+// EdgeCheck vetoes a connection between two nodes before it is written, by
+// returning an error, or flags it with the policy rule it violates.
+type EdgeCheck func(src, dst *Node) (violation string, err error)
+
+// Edge is a connection between two containers, with the traffic observed
+// on it since it was first seen.
+type Edge struct {
+	Src       string `json:"source"`
+	Dst       string `json:"destination"`
+	Bytes     uint64 `json:"bytes,omitempty"`
+	Packets   uint64 `json:"packets,omitempty"`
+	Violation string `json:"violation,omitempty"`
+}
+
+type Topology struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
 }
 
 type IGraph interface {
 	InitializedSchema() error
+	Ping() error
 	ExistID(id string) (bool, error)
 	Exist(stack, ip, host string) (bool, error)
 	FindByStack(stack string) (node []byte, err error)
 	FindNodeById(id string) (node []byte, err error)
 	FindNodeByIp(ip string) (node []byte, err error)
+	FindNode(id string) (*Node, error)
+	FindTopology(stack string) (*Topology, error)
 	DeleteNode(id string) error
-	InsertNode(info *pb.ContainerInfo) error
-	Connect(event *pb.ContainerEvent) (*Connection, error)
+	InsertNode(info *pb.ContainerInfo, agent string) error
+	UpdateNode(info *pb.ContainerInfo, agent string) error
+	Connect(event *pb.ContainerEvent, agent string, check EdgeCheck) (*Connection, error)
+	ExpireEdges(before time.Time) ([]Connection, error)
 }
 
+// NewGraphClient does not touch the backend: the schema is set up by MaintainSchema.
 func NewGraphClient(connection *grpc.ClientConn) IGraph {
 	log.Info("Creating a graph client")
-	graph := &GraphClient{cli: client.NewDgraphClient(api.NewDgraphClient(connection))}
-	if graph.InitializedSchema() != nil {
-		log.Fatal("Error while initializing schema")
-	}
-	return graph
+	return &GraphClient{cli: client.NewDgraphClient(api.NewDgraphClient(connection))}
 }
 
 func (g *GraphClient) InitializedSchema() error {
@@ -53,6 +95,7 @@ func (g *GraphClient) InitializedSchema() error {
 			network: string @index(exact, term) .
 			service: string @index(exact, term) .
 			host: string @index(exact, term) .
+			agent: string @index(exact) .
 			connected: uid @count .
 			parent: uid @count .
 		`,
@@ -63,6 +106,16 @@ func (g *GraphClient) InitializedSchema() error {
 	return nil
 }
 
+// Ping runs a trivial query to check that the backend answers.
+func (g *GraphClient) Ping() error {
+	_, err := g.cli.NewTxn().Query(context.Background(), `{
+	  ping(func: has(id), first: 1) {
+		uid
+	  }
+	}`)
+	return err
+}
+
 func (g *GraphClient) ExistID(id string) (bool, error) {
 	q := `{
 	  exist(func: eq(id, $id)) {
@@ -217,11 +270,15 @@ func (g *GraphClient) DeleteNode(id string) error {
 	return nil
 }
 
-func (g *GraphClient) InsertNode(info *pb.ContainerInfo) error {
+// InsertNode stores a container along with the agent that reported it.
+func (g *GraphClient) InsertNode(info *pb.ContainerInfo, agent string) error {
 	mu := &api.Mutation{
 		CommitNow: true,
 	}
-	bytes, err := json.Marshal(info)
+	bytes, err := json.Marshal(struct {
+		*pb.ContainerInfo
+		Agent string `json:"agent,omitempty"`
+	}{info, agent})
 	if err != nil {
 		log.Error(err)
 		return err
@@ -235,7 +292,46 @@ func (g *GraphClient) InsertNode(info *pb.ContainerInfo) error {
 	return nil
 }
 
-func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
+// UpdateNode rewrites the attributes of the node with the id of info.
+func (g *GraphClient) UpdateNode(info *pb.ContainerInfo, agent string) error {
+	q := `{
+	  find(func: eq(id, $id)) {
+		uid
+	  }
+	}`
+	txn := g.cli.NewTxn()
+	defer txn.Discard(context.Background())
+	r, err := txn.QueryWithVars(context.Background(), q, map[string]string{"$id": info.Id})
+	if err != nil {
+		return err
+	}
+	var root struct {
+		Find []struct {
+			Uid string `json:"uid"`
+		}
+	}
+	if err := json.Unmarshal(r.Json, &root); err != nil {
+		return err
+	}
+	if len(root.Find) == 0 {
+		return errors.New("Not found node with id " + info.Id)
+	}
+	bytes, err := json.Marshal(struct {
+		Uid string `json:"uid"`
+		*pb.ContainerInfo
+		Agent string `json:"agent,omitempty"`
+	}{root.Find[0].Uid, info, agent})
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(context.Background(), &api.Mutation{SetJson: bytes, CommitNow: true})
+	return err
+}
+
+// Connect adds an edge between the containers of an event. The reporting
+// agent is kept as a facet of the edge. A non nil check may refuse the edge,
+// or flag it with a violation facet.
+func (g *GraphClient) Connect(event *pb.ContainerEvent, agent string, check EdgeCheck) (*Connection, error) {
 
 	q := `{
 	  dest(func: eq(ip, $dest)) {
@@ -247,6 +343,7 @@ func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
 		network
 		host
 		service
+		agent
 		parent {
 			uid
 			name
@@ -264,7 +361,8 @@ func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
 		network
 		host
 		service
-		connected {
+		agent
+		connected @facets(agent, bytes, packets) {
 		  uid
 		  name
 		  id
@@ -283,6 +381,11 @@ func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
 	type node struct {
 		Uid       string `json:"uid,omitempty"`
 		Id        string `json:"id,omitempty"`
+		Agent     string `json:"connected|agent,omitempty"`
+		Bytes     uint64 `json:"connected|bytes,omitempty"`
+		Packets   uint64 `json:"connected|packets,omitempty"`
+		Violation string `json:"connected|violation,omitempty"`
+		Seen      int64  `json:"connected|seen,omitempty"`
 		Connected []node `json:"connected,omitempty"`
 		Parent    []node `json:"parent,omitempty"`
 	}
@@ -297,16 +400,46 @@ func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
 		return nil, e
 	}
 
-	rootNode.Src[0].Connected = append(rootNode.Src[0].Connected, rootNode.Dest[0])
-	rootNode.Dest[0].Parent = append(rootNode.Dest[0].Parent, rootNode.Src[0])
+	var endpoints struct {
+		Dest []Node
+		Src  []Node
+	}
+	e = json.Unmarshal(r.Json, &endpoints)
+	if e != nil {
+		return nil, e
+	}
+	if len(endpoints.Src) == 0 || len(endpoints.Dest) == 0 {
+		return nil, errors.New("unknown endpoint for connection " + event.IpSrc + " -> " + event.IpDst)
+	}
+	violation := ""
+	if check != nil {
+		if violation, e = check(&endpoints.Src[0], &endpoints.Dest[0]); e != nil {
+			return nil, e
+		}
+	}
 
-	fmt.Printf("data upadted: %+v\n", rootNode)
+	src, dst := rootNode.Src[0], rootNode.Dest[0]
+	log.WithField("source", src.Id).WithField("destination", dst.Id).WithField("agent", agent).Debug("Connection updated")
 
 	mu := &api.Mutation{
 		CommitNow: true,
 	}
 
-	b, e := json.Marshal(rootNode)
+	// Only the new edge is set, so that the facets of the existing ones stay.
+	// Its traffic counters carry on from the previous observations.
+	edge := node{Uid: dst.Uid, Agent: agent, Bytes: uint64(event.Size), Packets: 1, Violation: violation, Seen: time.Now().Unix()}
+	created := true
+	for _, c := range src.Connected {
+		if c.Uid == dst.Uid {
+			edge.Bytes += c.Bytes
+			edge.Packets += c.Packets
+			created = false
+		}
+	}
+	b, e := json.Marshal([]node{
+		{Uid: src.Uid, Connected: []node{edge}},
+		{Uid: dst.Uid, Parent: []node{{Uid: src.Uid}}},
+	})
 	if e != nil {
 		return nil, e
 	}
@@ -319,7 +452,101 @@ func (g *GraphClient) Connect(event *pb.ContainerEvent) (*Connection, error) {
 		return nil, e
 	}
 
-	return &Connection{Src: rootNode.Src[0].Id, Dst: rootNode.Dest[0].Id, Size: event.Size}, nil
+	return &Connection{
+		Src:       src.Id,
+		Dst:       dst.Id,
+		Size:      event.Size,
+		Agent:     agent,
+		Violation: violation,
+		SrcNode:   &endpoints.Src[0],
+		DstNode:   &endpoints.Dest[0],
+		New:       created,
+	}, nil
+}
+
+// ExpireEdges removes the edges last seen before the given time, including
+// the ones written before Connect recorded when an edge was seen, and
+// returns them.
+func (g *GraphClient) ExpireEdges(before time.Time) ([]Connection, error) {
+	q := `{
+	  find(func: has(connected)) {
+		uid
+		id
+		name
+		ip
+		stack
+		network
+		service
+		host
+		agent
+		connected @facets(seen) {
+		  uid
+		  id
+		  name
+		  ip
+		  stack
+		  network
+		  service
+		  host
+		  agent
+		}
+	  }
+	}`
+	txn := g.cli.NewTxn()
+	defer txn.Discard(context.Background())
+	r, err := txn.Query(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	type peer struct {
+		Node
+		Uid  string `json:"uid"`
+		Seen int64  `json:"connected|seen"`
+	}
+	type info struct {
+		Node
+		Uid       string `json:"uid"`
+		Connected []peer `json:"connected"`
+	}
+	var root struct {
+		Find []info
+	}
+	if err := json.Unmarshal(r.Json, &root); err != nil {
+		return nil, err
+	}
+
+	type edge struct {
+		Uid       string `json:"uid"`
+		Connected []edge `json:"connected,omitempty"`
+		Parent    []edge `json:"parent,omitempty"`
+	}
+	var expired []Connection
+	var deleted []edge
+	for i := range root.Find {
+		src := &root.Find[i]
+		for j := range src.Connected {
+			dst := &src.Connected[j]
+			if dst.Seen >= before.Unix() {
+				continue
+			}
+			deleted = append(deleted,
+				edge{Uid: src.Uid, Connected: []edge{{Uid: dst.Uid}}},
+				edge{Uid: dst.Uid, Parent: []edge{{Uid: src.Uid}}},
+			)
+			expired = append(expired, Connection{Src: src.Id, Dst: dst.Id, SrcNode: &src.Node, DstNode: &dst.Node})
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(deleted)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := txn.Mutate(context.Background(), &api.Mutation{DeleteJson: b, CommitNow: true}); err != nil {
+		return nil, err
+	}
+	return expired, nil
 }
 
 func (g *GraphClient) FindNodeById(id string) (n []byte, err error) {
@@ -427,7 +654,7 @@ func (g *GraphClient) FindByStack(stack string) (node []byte, err error) {
 			network
 			host
 			service
-			connected
+			connected @facets(violation)
 			parent
 		  }
 		}`
@@ -463,3 +690,118 @@ func (g *GraphClient) FindByStack(stack string) (node []byte, err error) {
 
 	return bytes, nil
 }
+
+func (g *GraphClient) FindNode(id string) (*Node, error) {
+	q := `{
+	  find(func: eq(id, $id)) {
+		name
+		id
+		ip
+		stack
+		network
+		host
+		service
+		agent
+	  }
+	}`
+	m := make(map[string]string)
+	m["$id"] = id
+	resp, err := g.cli.NewTxn().QueryWithVars(context.Background(), q, m)
+	if err != nil {
+		return nil, err
+	}
+
+	type rootNode struct {
+		Find []Node
+	}
+
+	var root rootNode
+	err = json.Unmarshal(resp.GetJson(), &root)
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Find) == 0 {
+		return nil, nil
+	}
+	return &root.Find[0], nil
+}
+
+// FindTopology returns the nodes of a stack and every edge touching them.
+// An empty stack returns the topology of the whole cluster.
+func (g *GraphClient) FindTopology(stack string) (*Topology, error) {
+	q := `{
+	  find(func: has(id)) {
+		name
+		id
+		ip
+		stack
+		network
+		host
+		service
+		agent
+		connected @facets(bytes, packets, violation) {
+		  id
+		}
+		parent {
+		  id
+		}
+	  }
+	}`
+	m := make(map[string]string)
+	if stack != "" {
+		q = strings.Replace(q, "has(id)", "eq(stack, $stack)", 1)
+		m["$stack"] = stack
+	}
+	resp, err := g.cli.NewTxn().QueryWithVars(context.Background(), q, m)
+	if err != nil {
+		return nil, err
+	}
+
+	type peer struct {
+		Id        string `json:"id"`
+		Bytes     uint64 `json:"connected|bytes"`
+		Packets   uint64 `json:"connected|packets"`
+		Violation string `json:"connected|violation"`
+	}
+
+	type info struct {
+		Node
+		Connected []peer `json:"connected"`
+		Parent    []peer `json:"parent"`
+	}
+
+	type rootNode struct {
+		Find []info
+	}
+
+	var root rootNode
+	err = json.Unmarshal(resp.GetJson(), &root)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Topology{Nodes: make([]Node, 0, len(root.Find)), Edges: make([]Edge, 0)}
+	// An edge is seen from both ends, only its source knows the traffic.
+	seen := make(map[[2]string]int)
+	add := func(e Edge) {
+		k := [2]string{e.Src, e.Dst}
+		if i, ok := seen[k]; ok {
+			if e.Packets > 0 {
+				t.Edges[i] = e
+			}
+			return
+		}
+		seen[k] = len(t.Edges)
+		t.Edges = append(t.Edges, e)
+	}
+	for _, n := range root.Find {
+		t.Nodes = append(t.Nodes, n.Node)
+		for _, c := range n.Connected {
+			add(Edge{Src: n.Id, Dst: c.Id, Bytes: c.Bytes, Packets: c.Packets, Violation: c.Violation})
+		}
+		for _, p := range n.Parent {
+			add(Edge{Src: p.Id, Dst: n.Id})
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"sort"
+)
+
+const (
+	// CHATTY_RATIO is how many times the average traffic a node must see
+	// to be flagged as chatty.
+	CHATTY_RATIO = 2
+)
+
+// Hotspot ranks a container by how much of the topology goes through it.
+type Hotspot struct {
+	Node        Node    `json:"node"`
+	InDegree    int     `json:"in_degree"`
+	OutDegree   int     `json:"out_degree"`
+	Bytes       uint64  `json:"bytes"`
+	Packets     uint64  `json:"packets"`
+	Betweenness float64 `json:"betweenness"`
+	// SinglePointOfFailure is set on the only replica of a service that
+	// other services depend on.
+	SinglePointOfFailure bool `json:"single_point_of_failure"`
+	// Chatty is set when the node sees CHATTY_RATIO times the average traffic.
+	Chatty bool `json:"chatty"`
+}
+
+// Hotspots ranks the nodes of the topology, most central first.
+func (t *Topology) Hotspots() []Hotspot {
+	index := t.index()
+	next := t.adjacency(Downstream)
+	replicas := make(map[[2]string]int)
+	for _, n := range t.Nodes {
+		replicas[[2]string{n.Stack, n.Service}]++
+	}
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	for id := range next {
+		if _, ok := index[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	betweenness := next.betweenness(ids)
+
+	hotspots := make(map[string]*Hotspot, len(t.Nodes))
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		hotspots[n.Id] = &Hotspot{Node: *n, Betweenness: betweenness[n.Id]}
+	}
+	for _, e := range t.Edges {
+		if h, ok := hotspots[e.Src]; ok {
+			h.OutDegree++
+			h.Bytes += e.Bytes
+			h.Packets += e.Packets
+		}
+		if h, ok := hotspots[e.Dst]; ok {
+			h.InDegree++
+			h.Bytes += e.Bytes
+			h.Packets += e.Packets
+			src, known := index[e.Src]
+			other := !known || src.Stack != h.Node.Stack || src.Service != h.Node.Service
+			if other && replicas[[2]string{h.Node.Stack, h.Node.Service}] == 1 {
+				h.SinglePointOfFailure = true
+			}
+		}
+	}
+
+	var total uint64
+	for _, h := range hotspots {
+		total += h.Bytes
+	}
+	ranked := make([]Hotspot, 0, len(hotspots))
+	for _, h := range hotspots {
+		h.Chatty = h.Bytes > 0 && h.Bytes*uint64(len(hotspots)) >= CHATTY_RATIO*total
+		ranked = append(ranked, *h)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Betweenness != b.Betweenness {
+			return a.Betweenness > b.Betweenness
+		}
+		if a.InDegree != b.InDegree {
+			return a.InDegree > b.InDegree
+		}
+		return a.Node.Id < b.Node.Id
+	})
+	return ranked
+}
+
+// betweenness computes the betweenness centrality of every node with
+// Brandes' algorithm, counting hops.
+func (a adjacency) betweenness(ids []string) map[string]float64 {
+	c := make(map[string]float64, len(ids))
+	for _, s := range ids {
+		var order []string
+		pred := make(map[string][]string)
+		sigma := map[string]float64{s: 1}
+		dist := map[string]int{s: 0}
+		queue := []string{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			order = append(order, v)
+			for _, w := range a[v] {
+				if _, seen := dist[w]; !seen {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					pred[w] = append(pred[w], v)
+				}
+			}
+		}
+		delta := make(map[string]float64)
+		for i := len(order) - 1; i >= 0; i-- {
+			w := order[i]
+			for _, v := range pred[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				c[w] += delta[w]
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,54 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Two front replicas go through a single gateway to two api replicas, one
+// of them talking a lot to the database.
+func hotspotsTopology() *Topology {
+	return &Topology{
+		Nodes: []Node{
+			{Id: "front-1", Stack: "web", Service: "front"},
+			{Id: "front-2", Stack: "web", Service: "front"},
+			{Id: "gw", Stack: "web", Service: "gateway"},
+			{Id: "api-1", Stack: "web", Service: "api"},
+			{Id: "api-2", Stack: "web", Service: "api"},
+			{Id: "db", Stack: "data", Service: "db"},
+		},
+		Edges: []Edge{
+			{Src: "front-1", Dst: "gw", Bytes: 10, Packets: 1},
+			{Src: "front-2", Dst: "gw", Bytes: 10, Packets: 1},
+			{Src: "gw", Dst: "api-1", Bytes: 10, Packets: 1},
+			{Src: "gw", Dst: "api-2", Bytes: 10, Packets: 1},
+			{Src: "api-1", Dst: "db", Bytes: 5000, Packets: 10},
+		},
+	}
+}
+
+func TestHotspots(t *testing.T) {
+	h := hotspotsTopology().Hotspots()
+	assert.Len(t, h, 6)
+	assert.Equal(t, "gw", h[0].Node.Id)
+	assert.Equal(t, 6.0, h[0].Betweenness)
+	assert.Equal(t, 2, h[0].InDegree)
+	assert.Equal(t, 2, h[0].OutDegree)
+	assert.True(t, h[0].SinglePointOfFailure)
+	assert.False(t, h[0].Chatty)
+
+	assert.Equal(t, "api-1", h[1].Node.Id)
+	assert.Equal(t, 3.0, h[1].Betweenness)
+	assert.True(t, h[1].Chatty)
+	assert.False(t, h[1].SinglePointOfFailure)
+
+	for _, hs := range h {
+		switch hs.Node.Id {
+		case "db":
+			assert.True(t, hs.SinglePointOfFailure)
+			assert.Equal(t, uint64(5000), hs.Bytes)
+		case "front-1", "front-2", "api-2":
+			assert.False(t, hs.SinglePointOfFailure)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package graph
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Weight is the cost model of path queries.
+type Weight string
+
+const (
+	// HOPS makes every edge cost the same.
+	HOPS Weight = "hops"
+	// TRAFFIC makes busy edges cheaper, so that the paths actually used
+	// come first: an edge costs 1/(1+packets).
+	TRAFFIC Weight = "traffic"
+)
+
+var ErrUnknownWeight = errors.New("unknown path weight")
+
+// Path is a loopless route between two containers.
+type Path struct {
+	Nodes []Node  `json:"nodes"`
+	Hops  int     `json:"hops"`
+	Bytes uint64  `json:"bytes"`
+	Cost  float64 `json:"cost"`
+}
+
+// Paths holds the shortest path between two containers, nil when there is
+// none, followed by the next best alternatives.
+type Paths struct {
+	From         Node   `json:"from"`
+	To           Node   `json:"to"`
+	Weight       Weight `json:"weight"`
+	Shortest     *Path  `json:"shortest"`
+	Alternatives []Path `json:"alternatives"`
+}
+
+type arc struct {
+	dst  string
+	cost float64
+	edge *Edge
+}
+
+type network map[string][]arc
+
+func (t *Topology) network(w Weight) (network, error) {
+	if w == "" {
+		w = HOPS
+	}
+	if w != HOPS && w != TRAFFIC {
+		return nil, ErrUnknownWeight
+	}
+	n := make(network)
+	for i := range t.Edges {
+		e := &t.Edges[i]
+		cost := 1.0
+		if w == TRAFFIC {
+			cost = 1 / (1 + float64(e.Packets))
+		}
+		n[e.Src] = append(n[e.Src], arc{dst: e.Dst, cost: cost, edge: e})
+	}
+	// Ties are broken on ids, for the same query to give the same answer.
+	for _, arcs := range n {
+		sort.Slice(arcs, func(i, j int) bool { return arcs[i].dst < arcs[j].dst })
+	}
+	return n, nil
+}
+
+type candidate struct {
+	id   string
+	cost float64
+}
+
+type frontier []candidate
+
+func (f frontier) Len() int { return len(f) }
+func (f frontier) Less(i, j int) bool {
+	if f[i].cost != f[j].cost {
+		return f[i].cost < f[j].cost
+	}
+	return f[i].id < f[j].id
+}
+func (f frontier) Swap(i, j int)       { f[i], f[j] = f[j], f[i] }
+func (f *frontier) Push(x interface{}) { *f = append(*f, x.(candidate)) }
+func (f *frontier) Pop() interface{} {
+	old := *f
+	c := old[len(old)-1]
+	*f = old[:len(old)-1]
+	return c
+}
+
+// shortest runs Dijkstra from src to dst, ignoring the removed nodes and
+// edges. It returns the ids along the path, or nil when dst is unreachable.
+func (n network) shortest(src, dst string, nodes map[string]bool, edges map[[2]string]bool) ([]string, float64) {
+	dist := map[string]float64{src: 0}
+	prev := make(map[string]string)
+	done := make(map[string]bool)
+	f := &frontier{{id: src}}
+	for f.Len() > 0 {
+		c := heap.Pop(f).(candidate)
+		if done[c.id] {
+			continue
+		}
+		done[c.id] = true
+		if c.id == dst {
+			break
+		}
+		for _, a := range n[c.id] {
+			if nodes[a.dst] || edges[[2]string{c.id, a.dst}] {
+				continue
+			}
+			d := c.cost + a.cost
+			if old, ok := dist[a.dst]; !ok || d < old {
+				dist[a.dst] = d
+				prev[a.dst] = c.id
+				heap.Push(f, candidate{id: a.dst, cost: d})
+			}
+		}
+	}
+	if !done[dst] {
+		return nil, 0
+	}
+	path := []string{dst}
+	for id := dst; id != src; {
+		id = prev[id]
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, dist[dst]
+}
+
+func (n network) cost(path []string) float64 {
+	total := 0.0
+	for i := 0; i+1 < len(path); i++ {
+		for _, a := range n[path[i]] {
+			if a.dst == path[i+1] {
+				total += a.cost
+			}
+		}
+	}
+	return total
+}
+
+func samePrefix(a, b []string, length int) bool {
+	if len(a) < length || len(b) < length {
+		return false
+	}
+	for i := 0; i < length; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Paths returns the shortest path from one container to another and up to
+// max alternatives, in increasing cost, using Yen's algorithm.
+func (t *Topology) Paths(from, to string, max int, w Weight) (*Paths, error) {
+	index := t.index()
+	src, ok := index[from]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	dst, ok := index[to]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	n, err := t.network(w)
+	if err != nil {
+		return nil, err
+	}
+	if w == "" {
+		w = HOPS
+	}
+	p := &Paths{From: *src, To: *dst, Weight: w, Alternatives: make([]Path, 0)}
+
+	first, _ := n.shortest(from, to, nil, nil)
+	if first == nil {
+		return p, nil
+	}
+	found := [][]string{first}
+	var candidates [][]string
+	known := map[string]bool{strings.Join(first, " "): true}
+	for len(found) <= max {
+		last := found[len(found)-1]
+		for i := 0; i+1 < len(last); i++ {
+			root := last[:i+1]
+			edges := make(map[[2]string]bool)
+			for _, f := range found {
+				if samePrefix(f, root, len(root)) && len(f) > i+1 {
+					edges[[2]string{f[i], f[i+1]}] = true
+				}
+			}
+			nodes := make(map[string]bool)
+			for _, id := range root[:i] {
+				nodes[id] = true
+			}
+			spur, _ := n.shortest(last[i], to, nodes, edges)
+			if spur == nil {
+				continue
+			}
+			path := append(append([]string{}, root[:i]...), spur...)
+			if key := strings.Join(path, " "); !known[key] {
+				known[key] = true
+				candidates = append(candidates, path)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ci, cj := n.cost(candidates[i]), n.cost(candidates[j])
+			if ci != cj {
+				return ci < cj
+			}
+			if len(candidates[i]) != len(candidates[j]) {
+				return len(candidates[i]) < len(candidates[j])
+			}
+			return strings.Join(candidates[i], " ") < strings.Join(candidates[j], " ")
+		})
+		found = append(found, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	for i, ids := range found {
+		path := t.path(ids, index, n)
+		if i == 0 {
+			p.Shortest = &path
+		} else {
+			p.Alternatives = append(p.Alternatives, path)
+		}
+	}
+	return p, nil
+}
+
+func (t *Topology) path(ids []string, index map[string]*Node, n network) Path {
+	p := Path{Nodes: make([]Node, 0, len(ids)), Hops: len(ids) - 1, Cost: n.cost(ids)}
+	for i, id := range ids {
+		node := Node{Id: id}
+		if found, ok := index[id]; ok {
+			node = *found
+		}
+		p.Nodes = append(p.Nodes, node)
+		if i+1 < len(ids) {
+			for _, a := range n[id] {
+				if a.dst == ids[i+1] {
+					p.Bytes += a.edge.Bytes
+				}
+			}
+		}
+	}
+	return p
+}
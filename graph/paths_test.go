@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// a -> b -> d, a -> c -> d, a -> proxy -> c, with most traffic through c.
+func pathsTopology() *Topology {
+	return &Topology{
+		Nodes: []Node{{Id: "a"}, {Id: "b"}, {Id: "c"}, {Id: "d"}, {Id: "proxy"}},
+		Edges: []Edge{
+			{Src: "a", Dst: "b", Packets: 1, Bytes: 10},
+			{Src: "b", Dst: "d", Packets: 1, Bytes: 10},
+			{Src: "a", Dst: "c", Packets: 99, Bytes: 1000},
+			{Src: "c", Dst: "d", Packets: 99, Bytes: 1000},
+			{Src: "a", Dst: "proxy"},
+			{Src: "proxy", Dst: "c"},
+		},
+	}
+}
+
+func nodeIds(p Path) []string {
+	ids := make([]string, 0, len(p.Nodes))
+	for _, n := range p.Nodes {
+		ids = append(ids, n.Id)
+	}
+	return ids
+}
+
+func TestPathsHops(t *testing.T) {
+	p, err := pathsTopology().Paths("a", "d", 5, HOPS)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "d"}, nodeIds(*p.Shortest))
+	assert.Equal(t, 2, p.Shortest.Hops)
+	assert.Equal(t, uint64(20), p.Shortest.Bytes)
+	assert.Len(t, p.Alternatives, 2)
+	assert.Equal(t, []string{"a", "c", "d"}, nodeIds(p.Alternatives[0]))
+	assert.Equal(t, []string{"a", "proxy", "c", "d"}, nodeIds(p.Alternatives[1]))
+}
+
+func TestPathsTraffic(t *testing.T) {
+	p, err := pathsTopology().Paths("a", "d", 1, TRAFFIC)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c", "d"}, nodeIds(*p.Shortest))
+	assert.Equal(t, []string{"a", "b", "d"}, nodeIds(p.Alternatives[0]))
+	assert.Len(t, p.Alternatives, 1)
+}
+
+func TestPathsUnreachable(t *testing.T) {
+	p, err := pathsTopology().Paths("d", "a", 3, HOPS)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Shortest)
+	assert.Empty(t, p.Alternatives)
+}
+
+func TestPathsErrors(t *testing.T) {
+	_, err := pathsTopology().Paths("a", "nope", 0, HOPS)
+	assert.Equal(t, ErrNodeNotFound, err)
+	_, err = pathsTopology().Paths("a", "d", 0, "weird")
+	assert.Equal(t, ErrUnknownWeight, err)
+}
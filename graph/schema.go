@@ -0,0 +1,54 @@
+package graph
+
+import (
+	"context"
+	"docker-visualizer/aggregator/utils"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+var (
+	ErrSchemaPending      = errors.New("schema not initialized")
+	ErrBackendUnavailable = errors.New("graph backend unavailable")
+)
+
+// MaintainSchema sets up the schema, retrying as configured, then watches the
+// backend connection: the schema is validated again each time the connection
+// recovers from a failure. report receives nil whenever the graph is usable
+// and the reason otherwise. It returns when the connection is shut down, or
+// with an error when the initial setup runs out of attempts.
+func MaintainSchema(g IGraph, conn *grpc.ClientConn, retry utils.RetryConfig, report func(error)) error {
+	report(ErrSchemaPending)
+	if err := utils.Retry(retry, "schema initialization", g.InitializedSchema); err != nil {
+		report(err)
+		return err
+	}
+	report(nil)
+
+	lost := false
+	state := conn.GetState()
+	for state != connectivity.Shutdown && conn.WaitForStateChange(context.Background(), state) {
+		state = conn.GetState()
+		switch state {
+		case connectivity.TransientFailure:
+			if !lost {
+				log.Warn("Lost connection to the graph backend")
+			}
+			lost = true
+			report(ErrBackendUnavailable)
+		case connectivity.Ready:
+			if !lost {
+				continue
+			}
+			log.Info("Graph backend is back, validating schema")
+			if err := utils.Retry(retry, "schema validation", g.InitializedSchema); err != nil {
+				report(err)
+				continue
+			}
+			lost = false
+			report(nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"docker-visualizer/aggregator/utils"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+type schemaStub struct {
+	IGraph
+	failures int
+	calls    int
+}
+
+func (g *schemaStub) InitializedSchema() error {
+	g.calls++
+	if g.calls <= g.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestMaintainSchema(t *testing.T) {
+	conn, err := grpc.Dial("127.0.0.1:1", grpc.WithInsecure())
+	assert.Nil(t, err)
+	g := &schemaStub{failures: 2}
+	reports := make(chan error, 16)
+	done := make(chan error)
+
+	go func() {
+		done <- MaintainSchema(g, conn, utils.RetryConfig{Initial: 1, Max: 2}, func(err error) {
+			select {
+			case reports <- err:
+			default:
+			}
+		})
+	}()
+	assert.Equal(t, ErrSchemaPending, <-reports)
+	assert.Nil(t, <-reports)
+	conn.Close()
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, 3, g.calls)
+}
+
+func TestMaintainSchemaAttempts(t *testing.T) {
+	conn, _ := grpc.Dial("127.0.0.1:1", grpc.WithInsecure())
+	defer conn.Close()
+	g := &schemaStub{failures: 5}
+
+	err := MaintainSchema(g, conn, utils.RetryConfig{Initial: 1, Max: 2, Attempts: 2}, func(error) {})
+
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, 2, g.calls)
+}
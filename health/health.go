@@ -0,0 +1,138 @@
+package health
+
+import (
+	"docker-visualizer/aggregator/logging"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var log = logging.For("health")
+
+type Check func() error
+
+// Health tracks the readiness of the aggregator components. A component is
+// either a check run on demand or a state reported with Set.
+type Health struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	states   map[string]error
+	grpc     *health.Server
+	services []string
+}
+
+var ErrNotStarted = errors.New("not started")
+
+func New() *Health {
+	return &Health{
+		checks: make(map[string]Check),
+		states: make(map[string]error),
+		grpc:   health.NewServer(),
+	}
+}
+
+func (h *Health) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Set records the state of a component. A nil error marks it as usable.
+func (h *Health) Set(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if prev, ok := h.states[name]; ok && (prev == nil) != (err == nil) {
+		log.WithField("component", name).WithField("error", err).Info("Component readiness changed")
+	}
+	h.states[name] = err
+}
+
+// Check runs every check and returns the state of each component.
+func (h *Health) Check() map[string]error {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.checks))
+	result := make(map[string]error, len(h.checks)+len(h.states))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	for name, err := range h.states {
+		result[name] = err
+	}
+	h.mu.RUnlock()
+	for name, c := range checks {
+		result[name] = c()
+	}
+	return result
+}
+
+func (h *Health) Ready() bool {
+	for _, err := range h.Check() {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterGrpc exposes the gRPC health checking service. The overall status
+// and the status of each given service follow the readiness of the aggregator.
+func (h *Health) RegisterGrpc(s *grpc.Server, services ...string) {
+	h.mu.Lock()
+	h.services = append(h.services, services...)
+	h.mu.Unlock()
+	healthpb.RegisterHealthServer(s, h.grpc)
+	h.update()
+}
+
+// Watch refreshes the gRPC serving status every interval.
+func (h *Health) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		h.update()
+	}
+}
+
+func (h *Health) update() {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if h.Ready() {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.grpc.SetServingStatus("", status)
+	for _, s := range h.services {
+		h.grpc.SetServingStatus(s, status)
+	}
+}
+
+func (h *Health) Register(router *httprouter.Router) {
+	router.GET("/healthz", h.liveness)
+	router.GET("/readyz", h.readiness)
+}
+
+func (h *Health) liveness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+func (h *Health) readiness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	result := h.Check()
+	status := http.StatusOK
+	components := make(map[string]string, len(result))
+	for name, err := range result {
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			components[name] = err.Error()
+		} else {
+			components[name] = "ok"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(components)
+}
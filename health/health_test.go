@@ -0,0 +1,69 @@
+package health
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth_Ready(t *testing.T) {
+	h := New()
+	assert.True(t, h.Ready())
+
+	h.Set("schema", ErrNotStarted)
+	assert.False(t, h.Ready())
+	h.Set("schema", nil)
+	assert.True(t, h.Ready())
+
+	var backend error
+	h.AddCheck("graph", func() error { return backend })
+	assert.True(t, h.Ready())
+	backend = errors.New("connection refused")
+	assert.False(t, h.Ready())
+	assert.Equal(t, backend, h.Check()["graph"])
+}
+
+func TestHealth_Handlers(t *testing.T) {
+	h := New()
+	router := httprouter.New()
+	h.Register(router)
+	h.Set("schema", ErrNotStarted)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+	assert.JSONEq(t, `{"schema":"not started"}`, w.Body.String())
+
+	h.Set("schema", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"schema":"ok"}`, w.Body.String())
+}
+
+func TestHealth_Grpc(t *testing.T) {
+	h := New()
+	h.Set("schema", ErrNotStarted)
+	h.RegisterGrpc(grpc.NewServer(), "containers.ContainerService")
+
+	r, err := h.grpc.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "containers.ContainerService"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, r.Status)
+
+	h.Set("schema", nil)
+	h.update()
+	r, _ = h.grpc.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, r.Status)
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"time"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-Id"
+	// REQUEST_ID_METADATA is the gRPC metadata key of the request ID.
+	REQUEST_ID_METADATA = "x-request-id"
+)
+
+type requestIdKey struct{}
+
+type identityKey struct{}
+
+var access = For("access")
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the ID of the request being served, or "".
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// AccessLog logs every HTTP request with its request ID, taken from the
+// X-Request-Id header or generated, and echoed in the response.
+func AccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if id == "" {
+			id = newRequestId()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r.WithContext(WithRequestId(r.Context(), id)))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		access.
+			WithField("request_id", id).
+			WithField("method", r.Method).
+			WithField("path", r.URL.Path).
+			WithField("status", sw.status).
+			WithField("size", sw.size).
+			WithField("remote", r.RemoteAddr).
+			WithField("duration", time.Since(start)).Info("HTTP request")
+	})
+}
+
+// SetIdentity records the caller identity in the access log of the call,
+// for the interceptors authenticating it after the access log.
+func SetIdentity(ctx context.Context, identity string) {
+	if p, ok := ctx.Value(identityKey{}).(*string); ok {
+		*p = identity
+	}
+}
+
+// GrpcAccessLog logs every gRPC call with its request ID, taken from the
+// x-request-id metadata or generated, and the caller identity set by the
+// interceptors behind it.
+type GrpcAccessLog struct{}
+
+func (a *GrpcAccessLog) start(ctx context.Context) (context.Context, string) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(REQUEST_ID_METADATA); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = newRequestId()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(REQUEST_ID_METADATA, id))
+	ctx = context.WithValue(ctx, identityKey{}, new(string))
+	return WithRequestId(ctx, id), id
+}
+
+func (a *GrpcAccessLog) log(ctx context.Context, id, method string, start time.Time, err error) {
+	entry := access.
+		WithField("request_id", id).
+		WithField("method", method).
+		WithField("code", status.Code(err).String()).
+		WithField("duration", time.Since(start))
+	if p, ok := peer.FromContext(ctx); ok {
+		entry = entry.WithField("remote", p.Addr.String())
+	}
+	if identity, _ := ctx.Value(identityKey{}).(*string); identity != nil && *identity != "" {
+		entry = entry.WithField("agent", *identity)
+	}
+	entry.Info("gRPC call")
+}
+
+func (a *GrpcAccessLog) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, id := a.start(ctx)
+	resp, err := handler(ctx, req)
+	a.log(ctx, id, info.FullMethod, start, err)
+	return resp, err
+}
+
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *GrpcAccessLog) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, id := a.start(ss.Context())
+	err := handler(srv, &loggedStream{ServerStream: ss, ctx: ctx})
+	a.log(ctx, id, info.FullMethod, start, err)
+	return err
+}
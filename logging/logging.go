@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+	// PACKETS samples the logs written for every container event.
+	PACKETS = "packets"
+)
+
+// Config sets the level and format of the logs. Subsystems overrides the
+// level of a subsystem logger; Sampling keeps one log out of N for the
+// named samplers.
+type Config struct {
+	Level      string            `json:"level"`
+	Format     string            `json:"format"`
+	Subsystems map[string]string `json:"subsystems"`
+	Sampling   map[string]int    `json:"sampling"`
+}
+
+// Sampler lets one call out of every N through.
+type Sampler struct {
+	every uint64
+	count uint64
+}
+
+var (
+	mu       sync.Mutex
+	config   = DefaultConfig()
+	loggers  = make(map[string]*logrus.Logger)
+	samplers = make(map[string]*Sampler)
+)
+
+func DefaultConfig() Config {
+	return Config{
+		Level:    "info",
+		Format:   FORMAT_TEXT,
+		Sampling: map[string]int{PACKETS: 100},
+	}
+}
+
+func formatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", FORMAT_TEXT:
+		return &logrus.TextFormatter{}, nil
+	case FORMAT_JSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, errors.New("unknown log format " + format)
+}
+
+func level(subsystem string) logrus.Level {
+	name := config.Level
+	if l, ok := config.Subsystems[subsystem]; ok {
+		name = l
+	}
+	l, err := logrus.ParseLevel(name)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return l
+}
+
+func configure(logger *logrus.Logger, subsystem string, f logrus.Formatter) {
+	logger.SetLevel(level(subsystem))
+	logger.SetFormatter(f)
+}
+
+// Setup applies the configuration to the standard logger and to every
+// subsystem logger, including the ones already handed out.
+func Setup(c Config) error {
+	f, err := formatter(c.Format)
+	if err != nil {
+		return err
+	}
+	if _, err := logrus.ParseLevel(c.Level); err != nil {
+		return err
+	}
+	for _, l := range c.Subsystems {
+		if _, err := logrus.ParseLevel(l); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	config = c
+	configure(logrus.StandardLogger(), "", f)
+	for name, logger := range loggers {
+		configure(logger, name, f)
+	}
+	for name, s := range samplers {
+		atomic.StoreUint64(&s.every, every(name))
+	}
+	return nil
+}
+
+// For returns the logger of a subsystem. Its entries carry a subsystem field.
+func For(subsystem string) *logrus.Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	logger, ok := loggers[subsystem]
+	if !ok {
+		logger = logrus.New()
+		f, err := formatter(config.Format)
+		if err != nil {
+			f = &logrus.TextFormatter{}
+		}
+		configure(logger, subsystem, f)
+		loggers[subsystem] = logger
+	}
+	return logger.WithField("subsystem", subsystem)
+}
+
+func every(name string) uint64 {
+	if n := config.Sampling[name]; n > 1 {
+		return uint64(n)
+	}
+	return 1
+}
+
+// Sample returns the named sampler.
+func Sample(name string) *Sampler {
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := samplers[name]
+	if !ok {
+		s = &Sampler{every: every(name)}
+		samplers[name] = s
+	}
+	return s
+}
+
+// Sample tells whether this call should be logged. The first call is.
+func (s *Sampler) Sample() bool {
+	every := atomic.LoadUint64(&s.every)
+	return atomic.AddUint64(&s.count, 1)%every == 1%every
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	defer Setup(DefaultConfig())
+	graph := For("graph")
+	bus := For("bus")
+	assert.Equal(t, logrus.InfoLevel, graph.Logger.GetLevel())
+
+	err := Setup(Config{Level: "warn", Format: FORMAT_JSON, Subsystems: map[string]string{"graph": "debug"}})
+	assert.Nil(t, err)
+	assert.Equal(t, logrus.DebugLevel, graph.Logger.GetLevel())
+	assert.Equal(t, logrus.WarnLevel, bus.Logger.GetLevel())
+	assert.Equal(t, logrus.WarnLevel, For("sse").Logger.GetLevel())
+	assert.IsType(t, &logrus.JSONFormatter{}, bus.Logger.Formatter)
+	assert.Equal(t, "graph", graph.Data["subsystem"])
+
+	assert.NotNil(t, Setup(Config{Level: "loud"}))
+	assert.NotNil(t, Setup(Config{Level: "info", Format: "xml"}))
+}
+
+func TestSampler(t *testing.T) {
+	defer Setup(DefaultConfig())
+	s := Sample("test")
+	assert.True(t, s.Sample())
+	assert.True(t, s.Sample())
+
+	Setup(Config{Level: "info", Sampling: map[string]int{"test": 3}})
+	sampled := 0
+	for i := 0; i < 9; i++ {
+		if s.Sample() {
+			sampled++
+		}
+	}
+	assert.Equal(t, 3, sampled)
+}
+
+func TestAccessLog(t *testing.T) {
+	var id string
+	h := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestId(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, w.Header().Get(REQUEST_ID_HEADER))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "abc")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, "abc", id)
+}
+
+func TestGrpcAccessLog(t *testing.T) {
+	hook := test.NewLocal(access.Logger)
+	a := &GrpcAccessLog{}
+	var id string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		id = RequestId(ctx)
+		SetIdentity(ctx, "node-1")
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(REQUEST_ID_METADATA, "abc"))
+	_, err := a.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/containers.ContainerService/AddNode"}, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", id)
+	assert.Equal(t, "node-1", hook.LastEntry().Data["agent"])
+	assert.Equal(t, "abc", hook.LastEntry().Data["request_id"])
+}
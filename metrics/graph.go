@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"docker-visualizer/aggregator/graph"
+	pb "docker-visualizer/proto/containers"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+const (
+	TOPOLOGY_CACHE = 15 * time.Second
+)
+
+type instrumentedGraph struct {
+	graph graph.IGraph
+}
+
+// topologyCollector reports the node and edge counts of the whole cluster,
+// once a graph is instrumented. Counts are cached so that frequent scrapes
+// do not hammer the backend.
+type topologyCollector struct {
+	graph   graph.IGraph
+	nodes   *prometheus.Desc
+	edges   *prometheus.Desc
+	mu      sync.Mutex
+	updated time.Time
+	t       *graph.Topology
+}
+
+var topology = &topologyCollector{
+	nodes: prometheus.NewDesc(NAMESPACE+"_graph_nodes", "Nodes currently stored in the graph.", nil, nil),
+	edges: prometheus.NewDesc(NAMESPACE+"_graph_edges", "Edges currently stored in the graph.", nil, nil),
+}
+
+// InstrumentGraph wraps a graph client to record the latency of every call
+// and counts its nodes and edges. The counts follow the last graph
+// instrumented.
+func InstrumentGraph(g graph.IGraph) graph.IGraph {
+	topology.mu.Lock()
+	defer topology.mu.Unlock()
+	topology.graph = g
+	topology.t = nil
+	return &instrumentedGraph{graph: g}
+}
+
+func (c *topologyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.nodes
+	ch <- c.edges
+}
+
+func (c *topologyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.graph == nil {
+		return
+	}
+	if c.t == nil || time.Since(c.updated) > TOPOLOGY_CACHE {
+		t, err := c.graph.FindTopology("")
+		if err != nil {
+			log.WithField("error", err).Error("Error while counting graph nodes")
+			return
+		}
+		c.t = t
+		c.updated = time.Now()
+	}
+	ch <- prometheus.MustNewConstMetric(c.nodes, prometheus.GaugeValue, float64(len(c.t.Nodes)))
+	ch <- prometheus.MustNewConstMetric(c.edges, prometheus.GaugeValue, float64(len(c.t.Edges)))
+}
+
+func observeGraph(method string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	GraphLatency.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
+
+func (g *instrumentedGraph) WithContext(ctx context.Context) graph.IGraph {
+	return &instrumentedGraph{graph: graph.WithContext(g.graph, ctx)}
+}
+
+func (g *instrumentedGraph) InitializedSchema() error {
+	start := time.Now()
+	err := g.graph.InitializedSchema()
+	observeGraph("InitializedSchema", start, err)
+	return err
+}
+
+func (g *instrumentedGraph) Ping() error {
+	start := time.Now()
+	err := g.graph.Ping()
+	observeGraph("Ping", start, err)
+	return err
+}
+
+func (g *instrumentedGraph) ExistID(id string) (bool, error) {
+	start := time.Now()
+	exist, err := g.graph.ExistID(id)
+	observeGraph("ExistID", start, err)
+	return exist, err
+}
+
+func (g *instrumentedGraph) Exist(stack, ip, host string) (bool, error) {
+	start := time.Now()
+	exist, err := g.graph.Exist(stack, ip, host)
+	observeGraph("Exist", start, err)
+	return exist, err
+}
+
+func (g *instrumentedGraph) FindByStack(stack string) ([]byte, error) {
+	start := time.Now()
+	b, err := g.graph.FindByStack(stack)
+	observeGraph("FindByStack", start, err)
+	return b, err
+}
+
+func (g *instrumentedGraph) FindNodeById(id string) ([]byte, error) {
+	start := time.Now()
+	b, err := g.graph.FindNodeById(id)
+	observeGraph("FindNodeById", start, err)
+	return b, err
+}
+
+func (g *instrumentedGraph) FindNodeByIp(ip string) ([]byte, error) {
+	start := time.Now()
+	b, err := g.graph.FindNodeByIp(ip)
+	observeGraph("FindNodeByIp", start, err)
+	return b, err
+}
+
+func (g *instrumentedGraph) FindNode(id string) (*graph.Node, error) {
+	start := time.Now()
+	n, err := g.graph.FindNode(id)
+	observeGraph("FindNode", start, err)
+	return n, err
+}
+
+func (g *instrumentedGraph) FindTopology(stack string) (*graph.Topology, error) {
+	start := time.Now()
+	t, err := g.graph.FindTopology(stack)
+	observeGraph("FindTopology", start, err)
+	return t, err
+}
+
+func (g *instrumentedGraph) DeleteNode(id string) error {
+	start := time.Now()
+	err := g.graph.DeleteNode(id)
+	observeGraph("DeleteNode", start, err)
+	return err
+}
+
+func (g *instrumentedGraph) InsertNode(info *pb.ContainerInfo, agent string) error {
+	start := time.Now()
+	err := g.graph.InsertNode(info, agent)
+	observeGraph("InsertNode", start, err)
+	return err
+}
+
+func (g *instrumentedGraph) UpdateNode(info *pb.ContainerInfo, agent string) error {
+	start := time.Now()
+	err := g.graph.UpdateNode(info, agent)
+	observeGraph("UpdateNode", start, err)
+	return err
+}
+
+func (g *instrumentedGraph) ExpireEdges(before time.Time) ([]graph.Connection, error) {
+	start := time.Now()
+	r, err := g.graph.ExpireEdges(before)
+	observeGraph("ExpireEdges", start, err)
+	return r, err
+}
+
+func (g *instrumentedGraph) Connect(event *pb.ContainerEvent, agent string, check graph.EdgeCheck) (*graph.Connection, error) {
+	start := time.Now()
+	c, err := g.graph.Connect(event, agent, check)
+	observeGraph("Connect", start, err)
+	return c, err
+}
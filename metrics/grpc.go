@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	GrpcActiveStreams.WithLabelValues(info.FullMethod).Inc()
+	defer GrpcActiveStreams.WithLabelValues(info.FullMethod).Dec()
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, start, err)
+	return err
+}
+
+func observe(method string, start time.Time, err error) {
+	GrpcLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	GrpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
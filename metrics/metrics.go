@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"docker-visualizer/aggregator/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+var log = logging.For("metrics")
+
+const (
+	NAMESPACE = "aggregator"
+)
+
+var (
+	GrpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "gRPC calls handled, by method and status code.",
+	}, []string{"method", "code"})
+
+	GrpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of gRPC calls, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	GrpcActiveStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "grpc",
+		Name:      "active_streams",
+		Help:      "gRPC streams currently open, by method.",
+	}, []string{"method"})
+
+	EventsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "ingestion",
+		Name:      "events_total",
+		Help:      "Container events received from agents, by stack.",
+	}, []string{"stack"})
+
+	GraphLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "graph",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of graph backend queries and mutations, by IGraph method and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+
+	QueueSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "queue",
+		Name:      "size",
+		Help:      "Graph mutations waiting in the queue for the backend to recover.",
+	})
+
+	QueueReplayed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "queue",
+		Name:      "replayed_total",
+		Help:      "Queued graph mutations applied once the backend recovered.",
+	})
+
+	QueueReplayFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "queue",
+		Name:      "replay_failures_total",
+		Help:      "Queued graph mutations dropped because they failed on replay.",
+	})
+
+	QueueDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "queue",
+		Name:      "dropped_total",
+		Help:      "Graph mutations rejected because the queue was full.",
+	})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "ratelimit",
+		Name:      "rejected_total",
+		Help:      "Requests and streamed messages rejected by rate limits, by transport.",
+	}, []string{"transport"})
+
+	SSEClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "sse",
+		Name:      "clients",
+		Help:      "Server sent event clients currently connected.",
+	})
+
+	SSEDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "sse",
+		Name:      "dropped_messages_total",
+		Help:      "Messages not delivered to a server sent event client that could not keep up.",
+	})
+
+	PolicyViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "policy",
+		Name:      "violations_total",
+		Help:      "Connections forbidden by the policy, by rule.",
+	}, []string{"rule"})
+
+	SinkFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "sink",
+		Name:      "publish_failures_total",
+		Help:      "Events the message broker sink could not encode or publish.",
+	})
+
+	Anomalies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "anomaly",
+		Name:      "raised_total",
+		Help:      "Anomalies raised on observed connections, by kind.",
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		GrpcRequests,
+		GrpcLatency,
+		GrpcActiveStreams,
+		EventsIngested,
+		GraphLatency,
+		QueueSize,
+		QueueReplayed,
+		QueueReplayFailures,
+		QueueDropped,
+		RateLimited,
+		SSEClients,
+		SSEDropped,
+		PolicyViolations,
+		SinkFailures,
+		Anomalies,
+		topology,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"docker-visualizer/aggregator/graph"
+	pb "docker-visualizer/proto/containers"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type graphStub struct {
+	graph.IGraph
+	calls int
+}
+
+func (g *graphStub) FindTopology(stack string) (*graph.Topology, error) {
+	g.calls++
+	return &graph.Topology{
+		Nodes: []graph.Node{{Id: "1"}, {Id: "2"}},
+		Edges: []graph.Edge{{Src: "1", Dst: "2"}},
+	}, nil
+}
+
+func (g *graphStub) Connect(event *pb.ContainerEvent, agent string, check graph.EdgeCheck) (*graph.Connection, error) {
+	return nil, errors.New("unknown ip")
+}
+
+// graphCalls counts the graph calls of a method. The metrics are global, so
+// tests compare them before and after the calls to run repeatedly.
+func graphCalls(method, result string) uint64 {
+	var m dto.Metric
+	GraphLatency.WithLabelValues(method, result).(prometheus.Metric).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Unary"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+
+	before := testutil.ToFloat64(GrpcRequests.WithLabelValues("/test/Unary", "NotFound"))
+	_, err := UnaryServerInterceptor(context.Background(), nil, info, handler)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(GrpcRequests.WithLabelValues("/test/Unary", "NotFound")))
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/test/Stream"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		assert.Equal(t, 1.0, testutil.ToFloat64(GrpcActiveStreams.WithLabelValues("/test/Stream")))
+		return nil
+	}
+
+	before := testutil.ToFloat64(GrpcRequests.WithLabelValues("/test/Stream", "OK"))
+	assert.Nil(t, StreamServerInterceptor(nil, nil, info, handler))
+	assert.Equal(t, 0.0, testutil.ToFloat64(GrpcActiveStreams.WithLabelValues("/test/Stream")))
+	assert.Equal(t, before+1, testutil.ToFloat64(GrpcRequests.WithLabelValues("/test/Stream", "OK")))
+}
+
+func TestInstrumentGraph(t *testing.T) {
+	stub := &graphStub{}
+	g := InstrumentGraph(stub)
+	InstrumentGraph(stub)
+
+	before := graphCalls("Connect", "error")
+	_, err := g.Connect(&pb.ContainerEvent{}, "", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, graphCalls("Connect", "error"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	Handler().ServeHTTP(w, req)
+	body := w.Body.String()
+	assert.Contains(t, body, "aggregator_graph_nodes 2")
+	assert.Contains(t, body, "aggregator_graph_edges 1")
+
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 1, stub.calls)
+}
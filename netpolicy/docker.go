@@ -0,0 +1,77 @@
+package netpolicy
+
+import (
+	"gopkg.in/yaml.v2"
+	"sort"
+)
+
+type composeNetwork struct {
+	Internal bool   `yaml:"internal,omitempty"`
+	External bool   `yaml:"external,omitempty"`
+	Name     string `yaml:"name,omitempty"`
+}
+
+type composeService struct {
+	Networks []string `yaml:"networks"`
+}
+
+type compose struct {
+	Services map[string]composeService `yaml:"services"`
+	Networks map[string]composeNetwork `yaml:"networks"`
+}
+
+func networkName(from, to Service) string {
+	if from.Stack == to.Stack {
+		return from.Name + "-" + to.Name
+	}
+	return from.Stack + "_" + from.Name + "-" + to.Stack + "_" + to.Name
+}
+
+// Docker renders a compose file fragment in which every pair of services
+// seen talking shares a dedicated internal network, and nothing else.
+// Pairs crossing stacks get external networks, to be created beforehand
+// and declared on the other stack as well.
+func (f *Flows) Docker() ([]byte, error) {
+	c := compose{
+		Services: make(map[string]composeService),
+		Networks: make(map[string]composeNetwork),
+	}
+	attach := func(s Service, network string) {
+		service := c.Services[s.Name]
+		service.Networks = append(service.Networks, network)
+		c.Services[s.Name] = service
+	}
+	for _, s := range f.Services {
+		c.Services[s.Name] = composeService{Networks: []string{}}
+	}
+	for _, from := range f.Services {
+		for _, to := range f.Egress[from] {
+			name := networkName(from, to)
+			if to.Stack == f.Stack {
+				c.Networks[name] = composeNetwork{Internal: true}
+				attach(from, name)
+				if to != from {
+					attach(to, name)
+				}
+				continue
+			}
+			c.Networks[name] = composeNetwork{External: true, Name: name}
+			attach(from, name)
+		}
+	}
+	for _, to := range f.Services {
+		for _, from := range f.Ingress[to] {
+			if from.Stack == f.Stack {
+				continue
+			}
+			name := networkName(from, to)
+			c.Networks[name] = composeNetwork{External: true, Name: name}
+			attach(to, name)
+		}
+	}
+	for name, s := range c.Services {
+		sort.Strings(s.Networks)
+		c.Services[name] = s
+	}
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,63 @@
+package netpolicy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CHAIN_PREFIX names the chain holding the rules of a stack.
+const CHAIN_PREFIX = "AGG-"
+
+// chain is the name of the stack's chain, within the 28 characters
+// iptables allows.
+func (f *Flows) chain() string {
+	name := CHAIN_PREFIX + strings.ToUpper(f.Stack)
+	if len(name) > 28 {
+		name = name[:28]
+	}
+	return name
+}
+
+// Iptables renders an iptables-restore input for the filter table. The
+// stack's chain accepts the observed container pairs and established
+// traffic, then drops anything else to or from the stack's containers.
+// It is meant to be jumped to from FORWARD or DOCKER-USER.
+func (f *Flows) Iptables() []byte {
+	var b bytes.Buffer
+	chain := f.chain()
+	fmt.Fprintf(&b, "*filter\n:%s - [0:0]\n", chain)
+	fmt.Fprintf(&b, "-A %s -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT\n", chain)
+
+	rules := make(map[string]bool)
+	for _, e := range f.Edges {
+		src, dst := f.Nodes[e.Src], f.Nodes[e.Dst]
+		if src.Ip == "" || dst.Ip == "" {
+			continue
+		}
+		rules[fmt.Sprintf("-A %s -s %s/32 -d %s/32 -j ACCEPT", chain, src.Ip, dst.Ip)] = true
+	}
+	accepts := make([]string, 0, len(rules))
+	for r := range rules {
+		accepts = append(accepts, r)
+	}
+	sort.Strings(accepts)
+	for _, r := range accepts {
+		b.WriteString(r + "\n")
+	}
+
+	ips := make([]string, 0)
+	for _, n := range f.Nodes {
+		if n.Stack == f.Stack && n.Ip != "" {
+			ips = append(ips, n.Ip)
+		}
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		fmt.Fprintf(&b, "-A %s -d %s/32 -j DROP\n", chain, ip)
+		fmt.Fprintf(&b, "-A %s -s %s/32 -j DROP\n", chain, ip)
+	}
+	b.WriteString("COMMIT\n")
+	return b.Bytes()
+}
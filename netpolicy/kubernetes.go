@@ -0,0 +1,101 @@
+package netpolicy
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SERVICE_LABEL is the pod label assumed to hold the service name.
+	SERVICE_LABEL = "app"
+	// NAMESPACE_LABEL is set by Kubernetes on every namespace.
+	NAMESPACE_LABEL = "kubernetes.io/metadata.name"
+)
+
+type labels map[string]string
+
+type selector struct {
+	MatchLabels labels `yaml:"matchLabels"`
+}
+
+type peer struct {
+	NamespaceSelector *selector `yaml:"namespaceSelector,omitempty"`
+	PodSelector       *selector `yaml:"podSelector,omitempty"`
+}
+
+type ingressRule struct {
+	From []peer `yaml:"from"`
+}
+
+type egressRule struct {
+	To []peer `yaml:"to"`
+}
+
+type metadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+type spec struct {
+	PodSelector selector      `yaml:"podSelector"`
+	PolicyTypes []string      `yaml:"policyTypes"`
+	Ingress     []ingressRule `yaml:"ingress"`
+	Egress      []egressRule  `yaml:"egress"`
+}
+
+type networkPolicy struct {
+	ApiVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+	Spec       spec     `yaml:"spec"`
+}
+
+// peers selects services by label, in their own namespace when they live
+// in another stack.
+func (f *Flows) peers(services []Service) []peer {
+	peers := make([]peer, 0, len(services))
+	for _, s := range services {
+		p := peer{PodSelector: &selector{MatchLabels: labels{SERVICE_LABEL: s.Name}}}
+		if s.Stack != f.Stack {
+			p.NamespaceSelector = &selector{MatchLabels: labels{NAMESPACE_LABEL: s.Stack}}
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// Kubernetes renders one NetworkPolicy per service of the stack, the stack
+// being the namespace. Services seen without traffic get empty rule lists,
+// which deny everything. Only container to container traffic is observed,
+// so egress to DNS or outside the cluster has to be added by hand.
+func (f *Flows) Kubernetes() ([]byte, error) {
+	var b bytes.Buffer
+	for i, s := range f.Services {
+		p := networkPolicy{
+			ApiVersion: "networking.k8s.io/v1",
+			Kind:       "NetworkPolicy",
+			Metadata:   metadata{Name: s.Name, Namespace: s.Stack},
+			Spec: spec{
+				PodSelector: selector{MatchLabels: labels{SERVICE_LABEL: s.Name}},
+				PolicyTypes: []string{"Ingress", "Egress"},
+				Ingress:     []ingressRule{},
+				Egress:      []egressRule{},
+			},
+		}
+		if from := f.Ingress[s]; len(from) > 0 {
+			p.Spec.Ingress = append(p.Spec.Ingress, ingressRule{From: f.peers(from)})
+		}
+		if to := f.Egress[s]; len(to) > 0 {
+			p.Spec.Egress = append(p.Spec.Egress, egressRule{To: f.peers(to)})
+		}
+		out, err := yaml.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		b.Write(out)
+	}
+	return b.Bytes(), nil
+}
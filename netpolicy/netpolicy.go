@@ -0,0 +1,117 @@
+package netpolicy
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"errors"
+	"sort"
+)
+
+const (
+	FORMAT_KUBERNETES = "kubernetes"
+	FORMAT_DOCKER     = "docker"
+	FORMAT_IPTABLES   = "iptables"
+)
+
+var ErrUnknownFormat = errors.New("unknown network policy format")
+
+// Service is a set of replicas, named within its stack.
+type Service struct {
+	Stack string
+	Name  string
+}
+
+// Flows is the least privilege view of a stack: every service of the stack
+// with the services it was seen talking to, and the container edges behind.
+type Flows struct {
+	Stack    string
+	Services []Service
+	Ingress  map[Service][]Service
+	Egress   map[Service][]Service
+	Nodes    map[string]*graph.Node
+	Edges    []graph.Edge
+}
+
+func serviceOf(n *graph.Node) Service {
+	name := n.Service
+	if name == "" {
+		name = n.Name
+	}
+	return Service{Stack: n.Stack, Name: name}
+}
+
+func (s Service) less(o Service) bool {
+	if s.Stack != o.Stack {
+		return s.Stack < o.Stack
+	}
+	return s.Name < o.Name
+}
+
+func sortServices(s []Service) {
+	sort.Slice(s, func(i, j int) bool { return s[i].less(s[j]) })
+}
+
+// Observed collects the flows of a stack from the cluster topology. Edges
+// with an endpoint unknown to the topology are left out.
+func Observed(t *graph.Topology, stack string) *Flows {
+	f := &Flows{
+		Stack:   stack,
+		Ingress: make(map[Service][]Service),
+		Egress:  make(map[Service][]Service),
+		Nodes:   make(map[string]*graph.Node),
+	}
+	services := make(map[Service]bool)
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		f.Nodes[n.Id] = n
+		if n.Stack == stack && !services[serviceOf(n)] {
+			services[serviceOf(n)] = true
+			f.Services = append(f.Services, serviceOf(n))
+		}
+	}
+	sortServices(f.Services)
+
+	seen := make(map[[2]Service]bool)
+	for _, e := range t.Edges {
+		src, ok := f.Nodes[e.Src]
+		if !ok {
+			continue
+		}
+		dst, ok := f.Nodes[e.Dst]
+		if !ok || (src.Stack != stack && dst.Stack != stack) {
+			continue
+		}
+		f.Edges = append(f.Edges, e)
+		from, to := serviceOf(src), serviceOf(dst)
+		if seen[[2]Service{from, to}] {
+			continue
+		}
+		seen[[2]Service{from, to}] = true
+		if to.Stack == stack {
+			f.Ingress[to] = append(f.Ingress[to], from)
+		}
+		if from.Stack == stack {
+			f.Egress[from] = append(f.Egress[from], to)
+		}
+	}
+	for _, s := range f.Ingress {
+		sortServices(s)
+	}
+	for _, s := range f.Egress {
+		sortServices(s)
+	}
+	return f
+}
+
+// Generate renders the flows of a stack as allow-lists in the given format.
+func Generate(t *graph.Topology, stack, format string) ([]byte, error) {
+	f := Observed(t, stack)
+	switch format {
+	case FORMAT_KUBERNETES:
+		return f.Kubernetes()
+	case FORMAT_DOCKER:
+		return f.Docker()
+	case FORMAT_IPTABLES:
+		return f.Iptables(), nil
+	}
+	return nil, ErrUnknownFormat
+}
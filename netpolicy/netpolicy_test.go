@@ -0,0 +1,89 @@
+package netpolicy
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"testing"
+)
+
+// front calls api, api calls the database of the data stack, and a batch
+// job of another stack calls api.
+func testTopology() *graph.Topology {
+	return &graph.Topology{
+		Nodes: []graph.Node{
+			{Id: "front-1", Stack: "web", Service: "front", Ip: "10.0.0.1"},
+			{Id: "front-2", Stack: "web", Service: "front", Ip: "10.0.0.2"},
+			{Id: "api-1", Stack: "web", Service: "api", Ip: "10.0.0.3"},
+			{Id: "idle", Stack: "web", Service: "idle", Ip: "10.0.0.4"},
+			{Id: "db-1", Stack: "data", Service: "db", Ip: "10.0.1.1"},
+			{Id: "batch-1", Stack: "jobs", Service: "batch", Ip: "10.0.2.1"},
+		},
+		Edges: []graph.Edge{
+			{Src: "front-1", Dst: "api-1"},
+			{Src: "front-2", Dst: "api-1"},
+			{Src: "api-1", Dst: "db-1"},
+			{Src: "batch-1", Dst: "api-1"},
+			{Src: "batch-1", Dst: "db-1"},
+			{Src: "api-1", Dst: "gone"},
+		},
+	}
+}
+
+func TestObserved(t *testing.T) {
+	f := Observed(testTopology(), "web")
+	api := Service{Stack: "web", Name: "api"}
+	assert.Equal(t, []Service{api, {Stack: "web", Name: "front"}, {Stack: "web", Name: "idle"}}, f.Services)
+	assert.Equal(t, []Service{{Stack: "jobs", Name: "batch"}, {Stack: "web", Name: "front"}}, f.Ingress[api])
+	assert.Equal(t, []Service{{Stack: "data", Name: "db"}}, f.Egress[api])
+	assert.Len(t, f.Edges, 4)
+}
+
+func TestKubernetes(t *testing.T) {
+	b, err := Generate(testTopology(), "web", FORMAT_KUBERNETES)
+	assert.Nil(t, err)
+	docs := strings.Split(string(b), "---\n")
+	assert.Len(t, docs, 3)
+
+	var api networkPolicy
+	assert.Nil(t, yaml.Unmarshal([]byte(docs[0]), &api))
+	assert.Equal(t, metadata{Name: "api", Namespace: "web"}, api.Metadata)
+	assert.Len(t, api.Spec.Ingress[0].From, 2)
+	assert.Equal(t, "jobs", api.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels[NAMESPACE_LABEL])
+	assert.Nil(t, api.Spec.Ingress[0].From[1].NamespaceSelector)
+	assert.Equal(t, "db", api.Spec.Egress[0].To[0].PodSelector.MatchLabels[SERVICE_LABEL])
+
+	assert.Contains(t, docs[2], "name: idle")
+	assert.Contains(t, docs[2], "ingress: []")
+}
+
+func TestDocker(t *testing.T) {
+	b, err := Generate(testTopology(), "web", FORMAT_DOCKER)
+	assert.Nil(t, err)
+	var c compose
+	assert.Nil(t, yaml.Unmarshal(b, &c))
+	assert.Equal(t, []string{"front-api", "jobs_batch-web_api", "web_api-data_db"}, c.Services["api"].Networks)
+	assert.Equal(t, []string{"front-api"}, c.Services["front"].Networks)
+	assert.Empty(t, c.Services["idle"].Networks)
+	assert.True(t, c.Networks["front-api"].Internal)
+	assert.True(t, c.Networks["web_api-data_db"].External)
+}
+
+func TestIptables(t *testing.T) {
+	b, err := Generate(testTopology(), "web", FORMAT_IPTABLES)
+	assert.Nil(t, err)
+	rules := string(b)
+	assert.True(t, strings.HasPrefix(rules, "*filter\n:AGG-WEB - [0:0]\n-A AGG-WEB -m conntrack"))
+	assert.Contains(t, rules, "-A AGG-WEB -s 10.0.0.1/32 -d 10.0.0.3/32 -j ACCEPT\n")
+	assert.Contains(t, rules, "-A AGG-WEB -s 10.0.2.1/32 -d 10.0.0.3/32 -j ACCEPT\n")
+	assert.NotContains(t, rules, "-s 10.0.2.1/32 -d 10.0.1.1/32")
+	assert.Contains(t, rules, "-A AGG-WEB -d 10.0.0.4/32 -j DROP\n")
+	assert.NotContains(t, rules, "-d 10.0.1.1/32 -j DROP")
+	assert.True(t, strings.HasSuffix(rules, "COMMIT\n"))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := Generate(testTopology(), "web", "pf")
+	assert.Equal(t, ErrUnknownFormat, err)
+}
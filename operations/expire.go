@@ -0,0 +1,41 @@
+package operations
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"time"
+)
+
+// ExpiryConfig ages out the edges without traffic for TTL milliseconds,
+// looked for every Interval. A zero TTL keeps the edges forever.
+type ExpiryConfig struct {
+	TTL      int `json:"ttl_ms"`
+	Interval int `json:"interval_ms"`
+}
+
+func DefaultExpiryConfig() ExpiryConfig {
+	return ExpiryConfig{Interval: 60000}
+}
+
+// ExpireEdges removes the idle edges from the graph forever, publishing
+// EDGE_EXPIRED for each of them.
+func ExpireEdges(c ExpiryConfig, b *bus.Bus, g graph.IGraph) {
+	ttl := time.Duration(c.TTL) * time.Millisecond
+	for range time.Tick(time.Duration(c.Interval) * time.Millisecond) {
+		expireEdges(b, g, time.Now().Add(-ttl))
+	}
+}
+
+func expireEdges(b *bus.Bus, g graph.IGraph, before time.Time) {
+	expired, err := g.ExpireEdges(before)
+	if err != nil {
+		log.WithField("error", err).Error("Error while expiring edges")
+		return
+	}
+	for i := range expired {
+		b.Publish(bus.Event{Type: bus.EDGE_EXPIRED, Connection: &expired[i]})
+	}
+	if len(expired) > 0 {
+		log.WithField("edges", len(expired)).Info("Idle edges expired")
+	}
+}
@@ -0,0 +1,30 @@
+package operations
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExpireEdges(t *testing.T) {
+	m := &graphMock{}
+	b := bus.New()
+	sub := b.Subscribe("test", 4, bus.DropNewest)
+	defer sub.Close()
+	before := time.Now()
+	m.On("ExpireEdges", before).Return([]graph.Connection{
+		{Src: "a", Dst: "b", SrcNode: &graph.Node{Id: "a"}, DstNode: &graph.Node{Id: "b"}},
+	}, nil).Once()
+	m.On("ExpireEdges", before).Return([]graph.Connection(nil), errors.New("down"))
+
+	expireEdges(b, m, before)
+	e := <-sub.Events()
+	assert.Equal(t, bus.EDGE_EXPIRED, e.Type)
+	assert.Equal(t, "b", e.Connection.Dst)
+
+	expireEdges(b, m, before)
+	assert.Len(t, sub.Events(), 0)
+}
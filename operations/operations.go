@@ -1,96 +1,157 @@
 package operations
 
 import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/events"
 	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/health"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
+	"docker-visualizer/aggregator/policy"
+	"docker-visualizer/aggregator/queue"
+	"docker-visualizer/aggregator/tracing"
 	pb "docker-visualizer/proto/containers"
-	"encoding/json"
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"io"
+	"time"
 )
 
-type clientEvent struct {
-	Action  string      `json:"action"`
-	Payload interface{} `json:"payload"`
-}
+var (
+	log     = logging.For("operations")
+	packets = logging.Sample(logging.PACKETS)
+)
 
 type server struct {
-	graph    graph.IGraph
-	streamer *chan []byte
+	graph  graph.IGraph
+	bus    *bus.Bus
+	queue  *queue.Queue
+	policy *policy.Engine
+	wake   chan struct{}
 }
 
-const (
-	EVENT_ADD     = "ADD"
-	EVENT_DELETE  = "DELETE"
-	EVENT_CONNECT = "CONNECT"
-)
-
-func NewGrpcOperations(stream *chan []byte, graph graph.IGraph) *grpc.Server {
-	grpcServer := grpc.NewServer()
-	pb.RegisterContainerServiceServer(grpcServer, &server{graph: graph, streamer: stream})
+// NewGrpcOperations builds the agent facing gRPC server. When q is not nil,
+// mutations are queued there while the graph backend is unavailable. When p
+// is not nil, every connection is evaluated against the policy.
+func NewGrpcOperations(b *bus.Bus, graph graph.IGraph, h *health.Health, q *queue.Queue, p *policy.Engine, opts ...grpc.ServerOption) *grpc.Server {
+	grpcServer := grpc.NewServer(opts...)
+	s := &server{graph: graph, bus: b, queue: q, policy: p, wake: make(chan struct{}, 1)}
+	pb.RegisterContainerServiceServer(grpcServer, s)
+	events.RegisterTopologyServiceServer(grpcServer, s)
+	if h != nil {
+		h.RegisterGrpc(grpcServer, "containers.ContainerService", "events.TopologyService")
+	}
+	if q != nil {
+		metrics.QueueSize.Set(float64(q.Len()))
+		go s.replay()
+	}
 	return grpcServer
 }
 
-func setClientEvent(action string, data interface{}) clientEvent {
-	return clientEvent{
-		Action:  action,
-		Payload: data,
+func (s *server) AddNode(ctx context.Context, containers *pb.ContainerInfo) (*pb.Response, error) {
+	log.WithField("Node", containers).Info("Inserting node")
+	agent := auth.AgentFromContext(ctx)
+	if !agent.AllowedHost(containers.Host) {
+		log.WithField("agent", agent.Name).WithField("host", containers.Host).Warn("Agent not allowed to report for host")
+		return nil, errPermission(agent, containers.Host)
+	}
+	if e := s.submit(ctx, mutation{Op: OP_ADD, Node: containers, Agent: agent.Identity()}); e != nil {
+		return nil, e
 	}
+	return &pb.Response{Success: true}, nil
 }
 
-func (s *server) AddNode(ctx context.Context, containers *pb.ContainerInfo) (*pb.Response, error) {
-	log.WithField("Node", containers).Info("Inserting node")
-	exist, e := s.graph.ExistID(containers.Id)
+func containerNode(c *pb.ContainerInfo) *graph.Node {
+	return &graph.Node{
+		Id:      c.Id,
+		Name:    c.Name,
+		Ip:      c.Ip,
+		Stack:   c.Stack,
+		Network: c.Network,
+		Service: c.Service,
+		Host:    c.Host,
+	}
+}
+
+func (s *server) addNode(ctx context.Context, containers *pb.ContainerInfo, agent *auth.Agent) error {
+	g := graph.WithContext(s.graph, ctx)
+	exist, e := g.ExistID(containers.Id)
 	if e != nil {
 		log.WithField("error", e).Error("Error while checking if node exist")
-		return nil, e
+		return e
 	}
+	n := containerNode(containers)
+	n.Agent = agentName(agent)
 	if !exist {
-		e := s.graph.InsertNode(containers)
+		e := g.InsertNode(containers, agentName(agent))
 		if e != nil {
 			log.WithField("error", e).Error("Error while inserting node")
-			return nil, e
+			return e
 		}
-		event := setClientEvent(EVENT_ADD, containers)
-		b, err := json.Marshal(event)
-		if err != nil {
-			log.WithField("error", err).Error("Error while marshalling event client")
-			return nil, err
-		}
-		*s.streamer <- b
-	} else {
+		s.publish(ctx, bus.Event{Type: bus.NODE_ADDED, Node: n})
+		return nil
+	}
+	return s.updateNode(ctx, containers, n)
+}
+
+// updateNode rewrites a node added again when its attributes changed, as
+// when a container is reattached to another network or host.
+func (s *server) updateNode(ctx context.Context, containers *pb.ContainerInfo, n *graph.Node) error {
+	g := graph.WithContext(s.graph, ctx)
+	old, e := g.FindNode(containers.Id)
+	if e != nil {
+		log.WithField("error", e).Error("Error while fetching node")
+		return e
+	}
+	if old != nil && *old == *n {
 		log.Info("Node " + containers.Id + " already exists")
+		return nil
 	}
-	return &pb.Response{Success: true}, nil
+	if e := g.UpdateNode(containers, n.Agent); e != nil {
+		log.WithField("error", e).Error("Error while updating node")
+		return e
+	}
+	s.publish(ctx, bus.Event{Type: bus.NODE_UPDATED, Node: n})
+	return nil
 }
 
 func (s *server) RemoveNode(ctx context.Context, containers *pb.ContainerID) (*pb.Response, error) {
-	exist, e := s.graph.ExistID(containers.Id)
+	agent := auth.AgentFromContext(ctx).Identity()
+	if e := s.submit(ctx, mutation{Op: OP_REMOVE, Id: containers, Agent: agent}); e != nil {
+		return nil, e
+	}
+	return &pb.Response{Success: true}, nil
+}
+
+func (s *server) removeNode(ctx context.Context, containers *pb.ContainerID, agent *auth.Agent) error {
+	g := graph.WithContext(s.graph, ctx)
+	node, e := g.FindNode(containers.Id)
 	if e != nil {
 		log.WithField("error", e).Error("Error while checking if node exist")
-		return nil, e
+		return e
+	}
+	if node != nil && !agent.AllowedHost(node.Host) {
+		log.WithField("agent", agent.Name).WithField("host", node.Host).Warn("Agent not allowed to remove node")
+		return errPermission(agent, node.Host)
 	}
-	if exist {
-		e := s.graph.DeleteNode(containers.Id)
+	if node != nil {
+		e := g.DeleteNode(containers.Id)
 		if e != nil {
 			log.WithField("error", e).Error("Error while removing node")
-			return nil, e
-		} else {
-			event := setClientEvent(EVENT_DELETE, containers)
-			b, err := json.Marshal(event)
-			if err != nil {
-				log.WithField("error", err).Error("Error while marshalling event client")
-				return nil, err
-			} else {
-				*s.streamer <- b
-			}
+			return e
 		}
+		s.publish(ctx, bus.Event{Type: bus.NODE_REMOVED, Node: node})
 	}
-	return &pb.Response{Success: true}, nil
+	return nil
 }
 
 func (s *server) StreamContainerEvents(stream pb.ContainerService_StreamContainerEventsServer) error {
+	agent := auth.AgentFromContext(stream.Context()).Identity()
 	for {
 		event, err := stream.Recv()
 		if err == io.EOF {
@@ -100,23 +161,72 @@ func (s *server) StreamContainerEvents(stream pb.ContainerService_StreamContaine
 			return err
 		}
 
-		log.
-			WithField("ipSrc", event.IpSrc).
-			WithField("ipDst", event.IpDst).
-			WithField("packet size", event.Size).
-			WithField("stack", event.Stack).Info("Received")
+		if packets.Sample() {
+			log.
+				WithField("ipSrc", event.IpSrc).
+				WithField("ipDst", event.IpDst).
+				WithField("packet size", event.Size).
+				WithField("stack", event.Stack).Debug("Received")
+		}
+		metrics.EventsIngested.WithLabelValues(event.Stack).Inc()
 
-		connection, err := s.graph.Connect(event)
-		if err != nil {
-			log.WithField("error", err).Error("Error while connecting node")
-		} else {
-			data := setClientEvent(EVENT_CONNECT, connection)
-			b, err := json.Marshal(data)
-			if err != nil {
-				log.WithField("error", err).Error("Error while marshalling event client")
-			} else {
-				*s.streamer <- b
-			}
+		// Every event gets its own trace, linked to the stream, so that
+		// sampling applies per event rather than to the whole stream.
+		ctx, span := tracing.Tracer().Start(stream.Context(), "ContainerEvent",
+			trace.WithNewRoot(),
+			trace.WithLinks(trace.LinkFromContext(stream.Context())),
+			trace.WithAttributes(attribute.String("stack", event.Stack)),
+		)
+		err = s.submit(ctx, mutation{Op: OP_CONNECT, Event: event, Agent: agent})
+		tracing.End(span, err)
+		if status.Code(err) == codes.PermissionDenied {
+			return err
 		}
 	}
 }
+
+// connect only accepts connections with at least one endpoint on a host
+// of the reporting agent. The accepted ones are evaluated against the
+// policy before being written, so that the edge carries its violation;
+// the violation is only recorded once the edge is written.
+func (s *server) connect(ctx context.Context, event *pb.ContainerEvent, agent *auth.Agent) error {
+	check := func(src, dst *graph.Node) (string, error) {
+		if !agent.AllowedHost(src.Host) && !agent.AllowedHost(dst.Host) {
+			log.WithField("agent", agent.Name).WithField("ipSrc", event.IpSrc).WithField("ipDst", event.IpDst).Warn("Agent not allowed to report connection")
+			return "", errPermission(agent, src.Host)
+		}
+		if s.policy == nil {
+			return "", nil
+		}
+		return s.policy.Evaluate(src, dst), nil
+	}
+	connection, err := graph.WithContext(s.graph, ctx).Connect(event, agentName(agent), check)
+	if err != nil {
+		log.WithField("error", err).Error("Error while connecting node")
+		return err
+	}
+	s.publish(ctx, bus.Event{Type: bus.CONNECTION_OBSERVED, Connection: connection})
+	var violation policy.Violation
+	flagged := false
+	if s.policy != nil {
+		violation, flagged = s.policy.Record(connection, time.Now())
+	}
+	if flagged {
+		s.publish(ctx, bus.Event{Type: bus.VIOLATION, Connection: connection, Reason: violation.Reason()})
+	}
+	if connection.New {
+		s.publish(ctx, bus.Event{Type: bus.EDGE_ADDED, Connection: connection})
+	}
+	return nil
+}
+
+func agentName(a *auth.Agent) string {
+	if a == nil {
+		return ""
+	}
+	return a.Name
+}
+
+func errPermission(a *auth.Agent, host string) error {
+	return status.Errorf(codes.PermissionDenied, "agent %s may not report for host %s", agentName(a), host)
+}
@@ -2,12 +2,19 @@ package operations
 
 import (
 	"context"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
 	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/health"
+	"docker-visualizer/aggregator/policy"
 	pb "docker-visualizer/proto/containers"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
+	"time"
 )
 
 type graphMock struct {
@@ -19,6 +26,11 @@ func (m *graphMock) InitializedSchema() error {
 	return args.Error(0)
 }
 
+func (m *graphMock) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *graphMock) ExistID(id string) (bool, error) {
 	args := m.Called(id)
 	return args.Bool(0), args.Error(1)
@@ -34,14 +46,32 @@ func (m *graphMock) DeleteNode(id string) error {
 	return args.Error(0)
 }
 
-func (m *graphMock) InsertNode(info *pb.ContainerInfo) error {
-	args := m.Called(info)
+func (m *graphMock) InsertNode(info *pb.ContainerInfo, agent string) error {
+	args := m.Called(info, agent)
 	return args.Error(0)
 }
 
-func (m *graphMock) Connect(event *pb.ContainerEvent) (*graph.Connection, error) {
-	args := m.Called(event)
-	return args.Get(0).(*graph.Connection), args.Error(1)
+func (m *graphMock) UpdateNode(info *pb.ContainerInfo, agent string) error {
+	args := m.Called(info, agent)
+	return args.Error(0)
+}
+
+func (m *graphMock) ExpireEdges(before time.Time) ([]graph.Connection, error) {
+	args := m.Called(before)
+	return args.Get(0).([]graph.Connection), args.Error(1)
+}
+
+func (m *graphMock) Connect(event *pb.ContainerEvent, agent string, check graph.EdgeCheck) (*graph.Connection, error) {
+	args := m.Called(event, agent)
+	c := args.Get(0).(*graph.Connection)
+	if check != nil && c != nil {
+		violation, err := check(c.SrcNode, c.DstNode)
+		if err != nil {
+			return nil, err
+		}
+		c.Violation = violation
+	}
+	return c, args.Error(1)
 }
 
 func (m *graphMock) FindNodeById(id string) (n []byte, err error) {
@@ -59,24 +89,37 @@ func (m *graphMock) FindByStack(stack string) (nodes []byte, err error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *graphMock) FindNode(id string) (*graph.Node, error) {
+	args := m.Called(id)
+	return args.Get(0).(*graph.Node), args.Error(1)
+}
+
+func (m *graphMock) FindTopology(stack string) (*graph.Topology, error) {
+	args := m.Called(stack)
+	return args.Get(0).(*graph.Topology), args.Error(1)
+}
+
 func (m *graphMock) Close() {
 	m.Called()
 }
 
 func TestNewGrpcOperations(t *testing.T) {
-	server := NewGrpcOperations(nil, nil)
+	server := NewGrpcOperations(nil, nil, nil, nil, nil)
 	assert.NotNil(t, server)
+
+	server = NewGrpcOperations(nil, nil, health.New(), nil, nil)
+	assert.Contains(t, server.GetServiceInfo(), "grpc.health.v1.Health")
 }
 
 func TestServer_AddNode(t *testing.T) {
-	stream := make(chan []byte, 1)
 	m := &graphMock{}
 	s := &server{
-		graph:    m,
-		streamer: &stream,
+		graph: m,
+		bus:   bus.New(),
 	}
+	sub := s.bus.Subscribe("test", 1, bus.DropNewest)
 	m.On("ExistID", "123").Return(false, nil)
-	m.On("InsertNode", mock.AnythingOfType("*containers.ContainerInfo")).Return(nil)
+	m.On("InsertNode", mock.AnythingOfType("*containers.ContainerInfo"), "").Return(nil)
 
 	container := pb.ContainerInfo{
 		Id: "123",
@@ -86,18 +129,42 @@ func TestServer_AddNode(t *testing.T) {
 	m.AssertNumberOfCalls(t, "ExistID", 1)
 	m.AssertNumberOfCalls(t, "InsertNode", 1)
 
-	a := <-*s.streamer
+	a := <-sub.Events()
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
-	assert.NotNil(t, a)
+	assert.Equal(t, bus.NODE_ADDED, a.Type)
+	assert.Equal(t, "123", a.Node.Id)
+}
+
+func TestServer_AddNodeUpdated(t *testing.T) {
+	m := &graphMock{}
+	s := &server{
+		graph: m,
+		bus:   bus.New(),
+	}
+	sub := s.bus.Subscribe("test", 2, bus.DropNewest)
+	m.On("ExistID", "123").Return(true, nil)
+	m.On("FindNode", "123").Return(&graph.Node{Id: "123", Host: "h1"}, nil)
+	m.On("UpdateNode", mock.AnythingOfType("*containers.ContainerInfo"), "").Return(nil)
+
+	_, e := s.AddNode(context.Background(), &pb.ContainerInfo{Id: "123", Host: "h1"})
+	assert.Nil(t, e)
+	m.AssertNotCalled(t, "UpdateNode", mock.Anything, mock.Anything)
+
+	_, e = s.AddNode(context.Background(), &pb.ContainerInfo{Id: "123", Host: "h2"})
+	assert.Nil(t, e)
+	m.AssertNumberOfCalls(t, "UpdateNode", 1)
+	u := <-sub.Events()
+	assert.Equal(t, bus.NODE_UPDATED, u.Type)
+	assert.Equal(t, "h2", u.Node.Host)
+	assert.Len(t, sub.Events(), 0)
 }
 
 func TestServer_AddNodeFailure(t *testing.T) {
-	stream := make(chan []byte, 1)
 	m := &graphMock{}
 	s := &server{
-		graph:    m,
-		streamer: &stream,
+		graph: m,
+		bus:   bus.New(),
 	}
 	m.On("ExistID", "123").Return(false, errors.New("error"))
 
@@ -112,3 +179,113 @@ func TestServer_AddNodeFailure(t *testing.T) {
 	assert.NotNil(t, e)
 	assert.Equal(t, "error", e.Error())
 }
+
+func TestServer_RemoveNode(t *testing.T) {
+	m := &graphMock{}
+	s := &server{
+		graph: m,
+		bus:   bus.New(),
+	}
+	sub := s.bus.Subscribe("test", 1, bus.DropNewest)
+	m.On("FindNode", "123").Return(&graph.Node{Id: "123", Stack: "front"}, nil)
+	m.On("DeleteNode", "123").Return(nil)
+
+	r, e := s.RemoveNode(context.Background(), &pb.ContainerID{Id: "123"})
+
+	m.AssertNumberOfCalls(t, "DeleteNode", 1)
+
+	a := <-sub.Events()
+	assert.Nil(t, e)
+	assert.NotNil(t, r)
+	assert.Equal(t, bus.NODE_REMOVED, a.Type)
+	assert.Equal(t, "front", a.Node.Stack)
+}
+
+func TestServer_AgentAuthorization(t *testing.T) {
+	m := &graphMock{}
+	s := &server{
+		graph: m,
+		bus:   bus.New(),
+	}
+	ctx := auth.WithAgent(context.Background(), &auth.Agent{Name: "node-1", Token: "secret", Hosts: []string{"host-1"}})
+	m.On("ExistID", "1").Return(false, nil)
+	m.On("InsertNode", mock.AnythingOfType("*containers.ContainerInfo"), "node-1").Return(nil)
+	m.On("FindNode", "2").Return(&graph.Node{Id: "2", Host: "host-2"}, nil)
+
+	_, e := s.AddNode(ctx, &pb.ContainerInfo{Id: "1", Host: "host-1"})
+	assert.Nil(t, e)
+	m.AssertCalled(t, "InsertNode", mock.AnythingOfType("*containers.ContainerInfo"), "node-1")
+
+	_, e = s.AddNode(ctx, &pb.ContainerInfo{Id: "3", Host: "host-2"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(e))
+	m.AssertNotCalled(t, "ExistID", "3")
+
+	_, e = s.RemoveNode(ctx, &pb.ContainerID{Id: "2"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(e))
+	m.AssertNotCalled(t, "DeleteNode", "2")
+}
+
+func TestServer_AgentConnect(t *testing.T) {
+	m := &graphMock{}
+	s := &server{
+		graph: m,
+		bus:   bus.New(),
+	}
+	agent := &auth.Agent{Name: "node-1", Hosts: []string{"host-1"}}
+	spoofed := &pb.ContainerEvent{IpSrc: "10.0.0.2", IpDst: "10.0.0.3"}
+	m.On("Connect", spoofed, "node-1").Return(&graph.Connection{
+		SrcNode: &graph.Node{Host: "host-2"},
+		DstNode: &graph.Node{Host: "host-3"},
+	}, nil)
+	event := &pb.ContainerEvent{IpSrc: "10.0.0.1", IpDst: "10.0.0.3"}
+	m.On("Connect", event, "node-1").Return(&graph.Connection{
+		Agent:   "node-1",
+		SrcNode: &graph.Node{Host: "host-1"},
+		DstNode: &graph.Node{Host: "host-3"},
+		New:     true,
+	}, nil)
+	sub := s.bus.Subscribe("test", 4, bus.DropNewest)
+	defer sub.Close()
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(s.connect(context.Background(), spoofed, agent)))
+	assert.Nil(t, s.connect(context.Background(), event, agent))
+	assert.Equal(t, bus.CONNECTION_OBSERVED, (<-sub.Events()).Type)
+	assert.Equal(t, bus.EDGE_ADDED, (<-sub.Events()).Type)
+}
+
+func TestServer_PolicyConnect(t *testing.T) {
+	p, _ := policy.Parse([]byte("default: allow\nrules:\n  - name: no-web-to-data\n    from: {stack: web}\n    to: {stack: data}\n    action: deny\n"))
+	m := &graphMock{}
+	s := &server{graph: m, bus: bus.New(), policy: policy.NewEngine(p, policy.DefaultConfig())}
+	event := &pb.ContainerEvent{IpSrc: "10.0.0.1", IpDst: "10.0.0.2", Size: 10}
+	connection := func() *graph.Connection {
+		return &graph.Connection{
+			Src:     "front",
+			Dst:     "db",
+			SrcNode: &graph.Node{Id: "front", Stack: "web"},
+			DstNode: &graph.Node{Id: "db", Stack: "data"},
+		}
+	}
+	m.On("Connect", event, "").Return(connection(), errors.New("down")).Once()
+	m.On("Connect", event, "").Return(connection(), nil)
+	sub := s.bus.Subscribe("test", 4, bus.DropNewest)
+	defer sub.Close()
+
+	// A failed write records nothing, so the next packet flags the edge.
+	assert.NotNil(t, s.connect(context.Background(), event, nil))
+	assert.Len(t, sub.Events(), 0)
+	assert.Len(t, s.policy.Violations(), 0)
+
+	assert.Nil(t, s.connect(context.Background(), event, nil))
+	observed := <-sub.Events()
+	assert.Equal(t, bus.CONNECTION_OBSERVED, observed.Type)
+	assert.Equal(t, "no-web-to-data", observed.Connection.Violation)
+	violation := <-sub.Events()
+	assert.Equal(t, bus.VIOLATION, violation.Type)
+	assert.Contains(t, violation.Reason, "no-web-to-data")
+
+	assert.Nil(t, s.connect(context.Background(), event, nil))
+	assert.Equal(t, bus.CONNECTION_OBSERVED, (<-sub.Events()).Type)
+	assert.Len(t, sub.Events(), 0)
+	assert.Len(t, s.policy.Violations(), 1)
+}
@@ -0,0 +1,153 @@
+package operations
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/metrics"
+	"docker-visualizer/aggregator/queue"
+	"docker-visualizer/aggregator/tracing"
+	pb "docker-visualizer/proto/containers"
+	"encoding/json"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const (
+	OP_ADD     = "add"
+	OP_REMOVE  = "remove"
+	OP_CONNECT = "connect"
+
+	REPLAY_INTERVAL = time.Second
+)
+
+// mutation is a graph change requested by an agent, as stored in the queue.
+type mutation struct {
+	Op    string             `json:"op"`
+	Node  *pb.ContainerInfo  `json:"node,omitempty"`
+	Id    *pb.ContainerID    `json:"id,omitempty"`
+	Event *pb.ContainerEvent `json:"event,omitempty"`
+	Agent *auth.Agent        `json:"agent,omitempty"`
+}
+
+func isUnavailable(err error) bool {
+	if err == graph.ErrBackendUnavailable {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+func (s *server) apply(ctx context.Context, m mutation) error {
+	switch m.Op {
+	case OP_ADD:
+		return s.addNode(ctx, m.Node, m.Agent)
+	case OP_REMOVE:
+		return s.removeNode(ctx, m.Id, m.Agent)
+	case OP_CONNECT:
+		return s.connect(ctx, m.Event, m.Agent)
+	}
+	log.WithField("op", m.Op).Error("Unknown queued mutation")
+	return nil
+}
+
+// authorized tells whether the agent may make the mutation without looking
+// up the graph: added nodes are checked before being submitted, removals and
+// connections only when the agent reports for every host.
+func (m mutation) authorized() bool {
+	return m.Op == OP_ADD || m.Agent.AllowedHost(auth.ALL_HOSTS)
+}
+
+// submit applies a mutation, or queues it while the graph backend is
+// unavailable. Once something is queued, later mutations are queued behind
+// it until the queue is drained, so that they reach the graph in order.
+// Mutations that cannot be authorized without the graph are refused rather
+// than acknowledged and dropped on replay.
+func (s *server) submit(ctx context.Context, m mutation) error {
+	if s.queue == nil {
+		return s.apply(ctx, m)
+	}
+	if s.queue.Len() == 0 {
+		err := s.apply(ctx, m)
+		if err == nil || !isUnavailable(err) {
+			return err
+		}
+		log.WithField("error", err).Warn("Graph backend unavailable, queueing mutation")
+	}
+	if !m.authorized() {
+		return status.Error(codes.Unavailable, "graph backend unavailable, cannot check the hosts of the agent")
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := s.queue.Push(b); err != nil {
+		metrics.QueueDropped.Inc()
+		log.WithField("error", err).Error("Cannot queue mutation")
+		return status.Error(codes.Unavailable, "graph backend unavailable and queue is full")
+	}
+	metrics.QueueSize.Set(float64(s.queue.Len()))
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// replay drains the queue in order, waiting for the backend to come back
+// when it is still unavailable. Mutations failing for another reason are
+// dropped so that they cannot block the queue.
+func (s *server) replay() {
+	ticker := time.NewTicker(REPLAY_INTERVAL)
+	defer ticker.Stop()
+	for {
+		b, err := s.queue.Peek()
+		if err != nil {
+			if err != queue.ErrEmpty {
+				log.WithField("error", err).Error("Cannot read queued mutation")
+			}
+			select {
+			case <-s.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		var m mutation
+		if err := json.Unmarshal(b, &m); err != nil {
+			log.WithField("error", err).Error("Dropping unreadable queued mutation")
+			metrics.QueueReplayFailures.Inc()
+		} else if err := s.replayOne(m); err != nil {
+			if isUnavailable(err) {
+				<-ticker.C
+				continue
+			}
+			log.WithField("op", m.Op).WithField("error", err).Error("Dropping queued mutation")
+			metrics.QueueReplayFailures.Inc()
+		} else {
+			metrics.QueueReplayed.Inc()
+		}
+
+		if err := s.queue.Pop(); err != nil {
+			log.WithField("error", err).Error("Cannot remove replayed mutation")
+		}
+		metrics.QueueSize.Set(float64(s.queue.Len()))
+	}
+}
+
+func (s *server) replayOne(m mutation) error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "queue.Replay", trace.WithAttributes(attribute.String("mutation.op", m.Op)))
+	err := s.apply(ctx, m)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *server) publish(ctx context.Context, e bus.Event) {
+	if s.bus != nil {
+		s.bus.PublishContext(ctx, e)
+	}
+}
@@ -0,0 +1,98 @@
+package operations
+
+import (
+	"context"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/queue"
+	pb "docker-visualizer/proto/containers"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newQueuedServer(t *testing.T, m *graphMock) (*server, func()) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.Nil(t, err)
+	q, err := queue.Open(queue.Config{Dir: dir, MaxEntries: 10})
+	assert.Nil(t, err)
+	s := &server{graph: m, bus: bus.New(), queue: q, wake: make(chan struct{}, 1)}
+	return s, func() {
+		q.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServer_QueueWhileUnavailable(t *testing.T) {
+	m := &graphMock{}
+	s, cleanup := newQueuedServer(t, m)
+	defer cleanup()
+	sub := s.bus.Subscribe("test", 2, bus.DropNewest)
+
+	m.On("ExistID", "1").Return(false, status.Error(codes.Unavailable, "down")).Once()
+	m.On("ExistID", "1").Return(false, nil)
+	m.On("ExistID", "2").Return(false, nil)
+	m.On("InsertNode", mock.AnythingOfType("*containers.ContainerInfo"), "").Return(nil)
+
+	r, e := s.AddNode(context.Background(), &pb.ContainerInfo{Id: "1"})
+	assert.Nil(t, e)
+	assert.True(t, r.Success)
+	r, e = s.AddNode(context.Background(), &pb.ContainerInfo{Id: "2"})
+	assert.Nil(t, e)
+	assert.True(t, r.Success)
+
+	assert.Equal(t, 2, s.queue.Len())
+	m.AssertNotCalled(t, "ExistID", "2")
+	m.AssertNotCalled(t, "InsertNode", mock.Anything, mock.Anything)
+
+	go s.replay()
+	for _, id := range []string{"1", "2"} {
+		select {
+		case e := <-sub.Events():
+			assert.Equal(t, bus.NODE_ADDED, e.Type)
+			assert.Equal(t, id, e.Node.Id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("queued mutation was not replayed")
+		}
+	}
+	assert.Equal(t, 0, s.queue.Len())
+}
+
+func TestServer_QueueOtherErrors(t *testing.T) {
+	m := &graphMock{}
+	s, cleanup := newQueuedServer(t, m)
+	defer cleanup()
+
+	m.On("ExistID", "1").Return(false, errors.New("error"))
+
+	r, e := s.AddNode(context.Background(), &pb.ContainerInfo{Id: "1"})
+	assert.Nil(t, r)
+	assert.NotNil(t, e)
+	assert.Equal(t, 0, s.queue.Len())
+}
+
+func TestServer_QueueUnauthorized(t *testing.T) {
+	m := &graphMock{}
+	s, cleanup := newQueuedServer(t, m)
+	defer cleanup()
+
+	m.On("FindNode", "1").Return((*graph.Node)(nil), status.Error(codes.Unavailable, "down"))
+
+	restricted := auth.WithAgent(context.Background(), &auth.Agent{Name: "a", Hosts: []string{"h1"}})
+	r, e := s.RemoveNode(restricted, &pb.ContainerID{Id: "1"})
+	assert.Nil(t, r)
+	assert.Equal(t, codes.Unavailable, status.Code(e))
+	assert.Equal(t, 0, s.queue.Len())
+
+	r, e = s.RemoveNode(context.Background(), &pb.ContainerID{Id: "1"})
+	assert.Nil(t, e)
+	assert.True(t, r.Success)
+	assert.Equal(t, 1, s.queue.Len())
+}
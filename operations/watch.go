@@ -0,0 +1,163 @@
+package operations
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/events"
+	"docker-visualizer/aggregator/graph"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	WATCHER_BUFFER = 256
+)
+
+type watchFilter struct {
+	stacks map[string]bool
+	hosts  map[string]bool
+	types  map[events.EventType]bool
+}
+
+func newWatchFilter(req *events.WatchRequest) *watchFilter {
+	f := &watchFilter{}
+	if len(req.Stacks) > 0 {
+		f.stacks = make(map[string]bool)
+		for _, s := range req.Stacks {
+			f.stacks[s] = true
+		}
+	}
+	if len(req.Hosts) > 0 {
+		f.hosts = make(map[string]bool)
+		for _, h := range req.Hosts {
+			f.hosts[h] = true
+		}
+	}
+	if len(req.Types) > 0 {
+		f.types = make(map[events.EventType]bool)
+		for _, t := range req.Types {
+			f.types[t] = true
+		}
+	}
+	return f
+}
+
+func (f *watchFilter) matchNode(n *graph.Node) bool {
+	if n == nil {
+		return f.stacks == nil && f.hosts == nil
+	}
+	return (f.stacks == nil || f.stacks[n.Stack]) && (f.hosts == nil || f.hosts[n.Host])
+}
+
+// match accepts an edge event when either of its endpoints passes the filter.
+// Observed connections, one per packet, are only sent when asked for.
+func (f *watchFilter) match(event *events.TopologyEvent, src, dst *graph.Node) bool {
+	if f.types == nil && event.Type == events.EventType_CONNECTION_OBSERVED {
+		return false
+	}
+	if f.types != nil && !f.types[event.Type] {
+		return false
+	}
+	if event.Edge != nil {
+		return f.matchNode(src) || f.matchNode(dst)
+	}
+	return f.matchNode(src)
+}
+
+// visible tells whether the principal may see every known node of an event.
+func visible(p *auth.Principal, nodes ...*graph.Node) bool {
+	for _, n := range nodes {
+		if n != nil && !p.Allowed(n.Stack) {
+			return false
+		}
+	}
+	return true
+}
+
+// WatchTopology streams the topology events the caller may see: the ones
+// whose nodes all belong to stacks its principal is allowed to read.
+func (s *server) WatchTopology(req *events.WatchRequest, stream events.TopologyService_WatchTopologyServer) error {
+	filter := newWatchFilter(req)
+	p := auth.FromContext(stream.Context())
+	sub := s.bus.Subscribe("watch", WATCHER_BUFFER, bus.Disconnect)
+	defer sub.Close()
+
+	if req.Snapshot {
+		if err := s.sendSnapshot(req, filter, p, stream); err != nil {
+			log.WithField("error", err).Error("Error while sending topology snapshot")
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-sub.Events():
+			nodes := e.Nodes()
+			event := events.NewTopologyEvent(e)
+			if event.Type == events.EventType_UNKNOWN {
+				continue
+			}
+			if !visible(p, nodes...) || !filter.match(event, nodes[0], nodes[len(nodes)-1]) {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-sub.Done():
+			return status.Error(codes.ResourceExhausted, "topology watcher fell behind")
+		}
+	}
+}
+
+// sendSnapshot leaves out the edges to nodes outside the snapshot, whose
+// stack is unknown, unless the principal may see every stack.
+func (s *server) sendSnapshot(req *events.WatchRequest, filter *watchFilter, p *auth.Principal, stream events.TopologyService_WatchTopologyServer) error {
+	stacks := req.Stacks
+	if len(stacks) == 0 {
+		stacks = []string{""}
+	}
+	sent := make(map[[2]string]bool)
+	for _, stack := range stacks {
+		t, err := graph.WithContext(s.graph, stream.Context()).FindTopology(stack)
+		if err != nil {
+			return err
+		}
+		nodes := make(map[string]*graph.Node, len(t.Nodes))
+		for i := range t.Nodes {
+			n := &t.Nodes[i]
+			nodes[n.Id] = n
+			event := &events.TopologyEvent{Type: events.EventType_NODE_ADDED, Node: events.NewNode(n), Snapshot: true}
+			if !visible(p, n) || !filter.match(event, n, nil) {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		for _, e := range t.Edges {
+			src, dst := nodes[e.Src], nodes[e.Dst]
+			if !visible(p, src, dst) || ((src == nil || dst == nil) && !p.Allowed(auth.ALL_STACKS)) {
+				continue
+			}
+			key := [2]string{e.Src, e.Dst}
+			if sent[key] {
+				continue
+			}
+			sent[key] = true
+			event := &events.TopologyEvent{
+				Type:     events.EventType_EDGE_ADDED,
+				Edge:     &events.Edge{Source: e.Src, Destination: e.Dst},
+				Snapshot: true,
+			}
+			if !filter.match(event, src, dst) {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+	return stream.Send(&events.TopologyEvent{Type: events.EventType_SNAPSHOT_END, Snapshot: true})
+}
@@ -0,0 +1,161 @@
+package operations
+
+import (
+	"context"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/events"
+	"docker-visualizer/aggregator/graph"
+	pb "docker-visualizer/proto/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+type watchStreamMock struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *events.TopologyEvent
+}
+
+func (m *watchStreamMock) Context() context.Context {
+	return m.ctx
+}
+
+func (m *watchStreamMock) Send(e *events.TopologyEvent) error {
+	m.sent <- e
+	return nil
+}
+
+func newWatchStreamMock() (*watchStreamMock, context.CancelFunc) {
+	return newPrincipalStreamMock(auth.Anonymous)
+}
+
+func newPrincipalStreamMock(p *auth.Principal) (*watchStreamMock, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(auth.WithPrincipal(context.Background(), p))
+	return &watchStreamMock{ctx: ctx, sent: make(chan *events.TopologyEvent, 16)}, cancel
+}
+
+func TestServer_WatchTopologySnapshot(t *testing.T) {
+	m := &graphMock{}
+	s := &server{graph: m, bus: bus.New()}
+	m.On("FindTopology", "front").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "front", Host: "h1"}, {Id: "b", Stack: "front", Host: "h2"}},
+		Edges: []graph.Edge{{Src: "a", Dst: "b"}},
+	}, nil)
+
+	stream, cancel := newWatchStreamMock()
+	done := make(chan error)
+	go func() {
+		done <- s.WatchTopology(&events.WatchRequest{Stacks: []string{"front"}, Hosts: []string{"h1"}, Snapshot: true}, stream)
+	}()
+
+	n := <-stream.sent
+	assert.Equal(t, events.EventType_NODE_ADDED, n.Type)
+	assert.Equal(t, "a", n.Node.Id)
+	assert.True(t, n.Snapshot)
+	e := <-stream.sent
+	assert.Equal(t, events.EventType_EDGE_ADDED, e.Type)
+	assert.Equal(t, "a", e.Edge.Source)
+	end := <-stream.sent
+	assert.Equal(t, events.EventType_SNAPSHOT_END, end.Type)
+
+	cancel()
+	assert.Nil(t, <-done)
+	m.AssertNumberOfCalls(t, "FindTopology", 1)
+}
+
+func TestServer_WatchTopologyFilter(t *testing.T) {
+	m := &graphMock{}
+	s := &server{graph: m, bus: bus.New()}
+	m.On("FindTopology", "back").Return(&graph.Topology{}, nil)
+	m.On("ExistID", "1").Return(false, nil)
+	m.On("ExistID", "2").Return(false, nil)
+	m.On("InsertNode", mock.AnythingOfType("*containers.ContainerInfo"), "").Return(nil)
+
+	watch, cancel := newWatchStreamMock()
+	done := make(chan error)
+	go func() {
+		done <- s.WatchTopology(&events.WatchRequest{Stacks: []string{"back"}, Snapshot: true}, watch)
+	}()
+	assert.Equal(t, events.EventType_SNAPSHOT_END, (<-watch.sent).Type)
+
+	s.AddNode(context.Background(), &pb.ContainerInfo{Id: "1", Stack: "front"})
+	s.AddNode(context.Background(), &pb.ContainerInfo{Id: "2", Stack: "back"})
+
+	e := <-watch.sent
+	assert.Equal(t, events.EventType_NODE_ADDED, e.Type)
+	assert.Equal(t, "2", e.Node.Id)
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Len(t, watch.sent, 0)
+}
+
+func TestWatchFilterConnections(t *testing.T) {
+	observed := &events.TopologyEvent{Type: events.EventType_CONNECTION_OBSERVED, Edge: &events.Edge{}}
+	assert.False(t, newWatchFilter(&events.WatchRequest{}).match(observed, nil, nil))
+	assert.True(t, newWatchFilter(&events.WatchRequest{Types: []events.EventType{events.EventType_CONNECTION_OBSERVED}}).match(observed, nil, nil))
+
+	violation := &events.TopologyEvent{Type: events.EventType_VIOLATION, Edge: &events.Edge{}}
+	assert.True(t, newWatchFilter(&events.WatchRequest{}).match(violation, nil, nil))
+}
+
+func TestServer_WatchTopologyOverrun(t *testing.T) {
+	m := &graphMock{}
+	s := &server{graph: m, bus: bus.New()}
+	m.On("FindTopology", "").Return(&graph.Topology{}, nil)
+
+	watch, cancel := newWatchStreamMock()
+	defer cancel()
+	watch.sent = make(chan *events.TopologyEvent, 1)
+	done := make(chan error)
+	go func() {
+		done <- s.WatchTopology(&events.WatchRequest{Snapshot: true}, watch)
+	}()
+	assert.Equal(t, events.EventType_SNAPSHOT_END, (<-watch.sent).Type)
+	for i := 0; i < WATCHER_BUFFER+10; i++ {
+		s.bus.Publish(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "1"}})
+	}
+	go func() {
+		for range watch.sent {
+		}
+	}()
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(<-done))
+}
+
+func TestServer_WatchTopologyAuthorization(t *testing.T) {
+	m := &graphMock{}
+	s := &server{graph: m, bus: bus.New()}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "front"}, {Id: "b", Stack: "back"}, {Id: "c", Stack: "front"}},
+		Edges: []graph.Edge{{Src: "a", Dst: "b"}, {Src: "a", Dst: "c"}, {Src: "c", Dst: "z"}},
+	}, nil)
+
+	watch, cancel := newPrincipalStreamMock(&auth.Principal{Name: "ui", Stacks: []string{"front"}})
+	done := make(chan error)
+	go func() {
+		done <- s.WatchTopology(&events.WatchRequest{Snapshot: true}, watch)
+	}()
+	assert.Equal(t, "a", (<-watch.sent).Node.Id)
+	assert.Equal(t, "c", (<-watch.sent).Node.Id)
+	e := <-watch.sent
+	assert.Equal(t, "a", e.Edge.Source)
+	assert.Equal(t, "c", e.Edge.Destination)
+	assert.Equal(t, events.EventType_SNAPSHOT_END, (<-watch.sent).Type)
+
+	back := &graph.Node{Id: "b", Stack: "back"}
+	front := &graph.Node{Id: "a", Stack: "front"}
+	s.bus.Publish(bus.Event{Type: bus.NODE_ADDED, Node: back})
+	s.bus.Publish(bus.Event{Type: bus.EDGE_ADDED, Connection: &graph.Connection{Src: "a", Dst: "b", SrcNode: front, DstNode: back}})
+	s.bus.Publish(bus.Event{Type: bus.NODE_ADDED, Node: front})
+	assert.Equal(t, "a", (<-watch.sent).Node.Id)
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Len(t, watch.sent, 0)
+}
@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+var log = logging.For("policy")
+
+type Config struct {
+	File          string `json:"file"`
+	MaxViolations int    `json:"max_violations"`
+}
+
+// Violation is a flagged edge: a connection forbidden by the policy, with
+// the traffic seen on it since it was first flagged.
+type Violation struct {
+	Source      graph.Node `json:"source"`
+	Destination graph.Node `json:"destination"`
+	Rule        string     `json:"rule"`
+	Count       uint64     `json:"count"`
+	Bytes       uint64     `json:"bytes"`
+	First       time.Time  `json:"first"`
+	Last        time.Time  `json:"last"`
+}
+
+// Engine evaluates the observed connections against a policy as they are
+// ingested. It keeps the latest MaxViolations flagged edges in memory, the
+// graph keeps the rule on the edge itself.
+type Engine struct {
+	config     Config
+	policy     *Policy
+	mu         sync.RWMutex
+	violations map[[2]string]*Violation
+}
+
+func DefaultConfig() Config {
+	return Config{MaxViolations: 10000}
+}
+
+func New(c Config) (*Engine, error) {
+	p, err := Load(c.File)
+	if err != nil {
+		return nil, err
+	}
+	return NewEngine(p, c), nil
+}
+
+func NewEngine(p *Policy, c Config) *Engine {
+	return &Engine{config: c, policy: p, violations: make(map[[2]string]*Violation)}
+}
+
+// Reason explains the violation in alerts.
+func (v Violation) Reason() string {
+	return "connection denied by policy rule " + v.Rule
+}
+
+// Evaluate returns the rule forbidding a connection from src to dst, empty
+// when the policy allows it. Nothing is recorded.
+func (e *Engine) Evaluate(src, dst *graph.Node) string {
+	if allowed, rule := e.policy.Evaluate(src, dst); !allowed {
+		return rule
+	}
+	return ""
+}
+
+// Check records the connection when the policy forbids it, and reports
+// whether the edge is newly flagged. The rule of the returned violation is
+// empty when the connection is allowed.
+func (e *Engine) Check(c *graph.Connection, at time.Time) (Violation, bool) {
+	return e.record(c, e.Evaluate(c.SrcNode, c.DstNode), at)
+}
+
+// Record is Check for a connection already evaluated and written to the
+// graph with its violation, if any.
+func (e *Engine) Record(c *graph.Connection, at time.Time) (Violation, bool) {
+	return e.record(c, c.Violation, at)
+}
+
+func (e *Engine) record(c *graph.Connection, rule string, at time.Time) (Violation, bool) {
+	if rule == "" {
+		return Violation{}, false
+	}
+	metrics.PolicyViolations.WithLabelValues(rule).Inc()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := [2]string{c.Src, c.Dst}
+	if v, ok := e.violations[key]; ok {
+		v.Count++
+		v.Bytes += uint64(c.Size)
+		v.Last = at
+		v.Rule = rule
+		return *v, false
+	}
+	v := &Violation{Rule: rule, Count: 1, Bytes: uint64(c.Size), First: at, Last: at}
+	if c.SrcNode != nil {
+		v.Source = *c.SrcNode
+	}
+	if c.DstNode != nil {
+		v.Destination = *c.DstNode
+	}
+	e.violations[key] = v
+	e.evict()
+	log.WithField("source", c.Src).WithField("destination", c.Dst).WithField("rule", rule).Warn("Policy violation")
+	return *v, true
+}
+
+// evict drops the least recently seen violation once over the limit.
+func (e *Engine) evict() {
+	if e.config.MaxViolations <= 0 || len(e.violations) <= e.config.MaxViolations {
+		return
+	}
+	var oldest [2]string
+	var last time.Time
+	for k, v := range e.violations {
+		if last.IsZero() || v.Last.Before(last) {
+			oldest, last = k, v.Last
+		}
+	}
+	delete(e.violations, oldest)
+}
+
+// Violations lists the flagged edges, most recently seen first.
+func (e *Engine) Violations() []Violation {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	violations := make([]Violation, 0, len(e.violations))
+	for _, v := range e.violations {
+		violations = append(violations, *v)
+	}
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Last.After(violations[j].Last) })
+	return violations
+}
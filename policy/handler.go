@@ -0,0 +1,45 @@
+package policy
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type Handler struct {
+	engine *Engine
+}
+
+func NewHandler(e *Engine) *Handler {
+	return &Handler{engine: e}
+}
+
+func (h *Handler) Register(router *httprouter.Router, a *auth.Auth) {
+	router.GET("/violations", a.Wrap(h.list))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+// list answers the violations between stacks the caller may read,
+// optionally those involving a given stack.
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	p := auth.FromContext(r.Context())
+	stack := r.URL.Query().Get("stack")
+	violations := make([]Violation, 0)
+	for _, v := range h.engine.Violations() {
+		if !p.Allowed(v.Source.Stack) || !p.Allowed(v.Destination.Stack) {
+			continue
+		}
+		if stack != "" && v.Source.Stack != stack && v.Destination.Stack != stack {
+			continue
+		}
+		violations = append(violations, v)
+	}
+	writeJSON(w, violations)
+}
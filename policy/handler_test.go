@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/graph"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	p, _ := Parse([]byte(testPolicy))
+	e := NewEngine(p, DefaultConfig())
+	e.Check(&graph.Connection{Src: "front", Dst: "db", SrcNode: front, DstNode: db}, time.Now())
+	e.Check(&graph.Connection{Src: "db", Dst: "api", SrcNode: db, DstNode: api}, time.Now())
+	e.Check(&graph.Connection{Src: "x", Dst: "y", SrcNode: &graph.Node{Stack: "ops"}, DstNode: &graph.Node{Stack: "ops"}}, time.Now())
+
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web", "data"}}}})
+	router := httprouter.New()
+	NewHandler(e).Register(router, a)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/violations", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/violations", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"no-front-to-data"`)
+	assert.NotContains(t, w.Body.String(), `"ops"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/violations?stack=ops", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "[]\n", w.Body.String())
+}
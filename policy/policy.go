@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+)
+
+const (
+	ALLOW = "allow"
+	DENY  = "deny"
+	// ANY matches every value of a selector field, like an empty one.
+	ANY = "*"
+)
+
+// Selector matches the containers on one side of a connection. Empty
+// fields match everything.
+type Selector struct {
+	Stack   string `yaml:"stack" json:"stack,omitempty"`
+	Service string `yaml:"service" json:"service,omitempty"`
+	Network string `yaml:"network" json:"network,omitempty"`
+	Host    string `yaml:"host" json:"host,omitempty"`
+}
+
+type Rule struct {
+	Name   string   `yaml:"name" json:"name"`
+	From   Selector `yaml:"from" json:"from"`
+	To     Selector `yaml:"to" json:"to"`
+	Action string   `yaml:"action" json:"action"`
+}
+
+// Policy is an ordered list of rules: the first rule matching a connection
+// decides, and Default applies when none does.
+//
+//	default: deny
+//	rules:
+//	  - name: front-to-api
+//	    from: {stack: web, service: front}
+//	    to: {stack: web, service: api}
+//	    action: allow
+type Policy struct {
+	Default string `yaml:"default" json:"default"`
+	Rules   []Rule `yaml:"rules" json:"rules"`
+}
+
+func field(selector, value string) bool {
+	return selector == "" || selector == ANY || selector == value
+}
+
+func (s Selector) match(n *graph.Node) bool {
+	if n == nil {
+		n = &graph.Node{}
+	}
+	return field(s.Stack, n.Stack) && field(s.Service, n.Service) && field(s.Network, n.Network) && field(s.Host, n.Host)
+}
+
+// Parse reads a YAML policy, allowing by default.
+func Parse(b []byte) (*Policy, error) {
+	p := &Policy{Default: ALLOW}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, err
+	}
+	if p.Default != ALLOW && p.Default != DENY {
+		return nil, fmt.Errorf("policy default must be %s or %s", ALLOW, DENY)
+	}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("policy rule %d has no name", i)
+		}
+		if r.Action != ALLOW && r.Action != DENY {
+			return nil, fmt.Errorf("policy rule %s: action must be %s or %s", r.Name, ALLOW, DENY)
+		}
+	}
+	return p, nil
+}
+
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return nil, errors.New("no policy file")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Evaluate tells whether a connection from src to dst is allowed, along
+// with the name of the deciding rule, "default" when no rule matched.
+func (p *Policy) Evaluate(src, dst *graph.Node) (bool, string) {
+	for _, r := range p.Rules {
+		if r.From.match(src) && r.To.match(dst) {
+			return r.Action == ALLOW, r.Name
+		}
+	}
+	return p.Default == ALLOW, "default"
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: no-front-to-data
+    from: {stack: web, service: front}
+    to: {stack: data}
+    action: deny
+  - name: web-to-data
+    from: {stack: web}
+    to: {stack: data}
+    action: allow
+  - name: within-web
+    from: {stack: web}
+    to: {stack: web}
+    action: allow
+`
+
+var (
+	front = &graph.Node{Id: "front", Stack: "web", Service: "front"}
+	api   = &graph.Node{Id: "api", Stack: "web", Service: "api"}
+	db    = &graph.Node{Id: "db", Stack: "data", Service: "db"}
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	assert.Nil(t, err)
+	assert.Len(t, p.Rules, 3)
+
+	_, err = Parse([]byte("default: maybe"))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte("rules: [{name: r, action: block}]"))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte("rules: [{action: allow}]"))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte("unknown: field"))
+	assert.NotNil(t, err)
+
+	p, err = Parse([]byte(""))
+	assert.Nil(t, err)
+	allowed, rule := p.Evaluate(front, db)
+	assert.True(t, allowed)
+	assert.Equal(t, "default", rule)
+}
+
+func TestEvaluate(t *testing.T) {
+	p, _ := Parse([]byte(testPolicy))
+
+	allowed, rule := p.Evaluate(front, db)
+	assert.False(t, allowed)
+	assert.Equal(t, "no-front-to-data", rule)
+
+	allowed, rule = p.Evaluate(api, db)
+	assert.True(t, allowed)
+	assert.Equal(t, "web-to-data", rule)
+
+	allowed, rule = p.Evaluate(db, api)
+	assert.False(t, allowed)
+	assert.Equal(t, "default", rule)
+}
+
+func TestEngineCheck(t *testing.T) {
+	p, _ := Parse([]byte(testPolicy))
+	e := NewEngine(p, Config{MaxViolations: 1})
+	now := time.Now()
+
+	_, flagged := e.Check(&graph.Connection{Src: "api", Dst: "db", SrcNode: api, DstNode: db}, now)
+	assert.False(t, flagged)
+
+	v, flagged := e.Check(&graph.Connection{Src: "front", Dst: "db", SrcNode: front, DstNode: db, Size: 10}, now)
+	assert.True(t, flagged)
+	assert.Equal(t, "no-front-to-data", v.Rule)
+
+	v, flagged = e.Check(&graph.Connection{Src: "front", Dst: "db", SrcNode: front, DstNode: db, Size: 5}, now.Add(time.Second))
+	assert.False(t, flagged)
+	assert.Equal(t, uint64(2), v.Count)
+	assert.Equal(t, uint64(15), v.Bytes)
+
+	_, flagged = e.Check(&graph.Connection{Src: "db", Dst: "api", SrcNode: db, DstNode: api}, now.Add(2*time.Second))
+	assert.True(t, flagged)
+	violations := e.Violations()
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "db", violations[0].Source.Id)
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	p, _ := Parse([]byte(testPolicy))
+	e := NewEngine(p, DefaultConfig())
+
+	assert.Equal(t, "", e.Evaluate(api, db))
+	assert.Equal(t, "no-front-to-data", e.Evaluate(front, db))
+	assert.Len(t, e.Violations(), 0)
+
+	_, flagged := e.Record(&graph.Connection{Src: "api", Dst: "db", SrcNode: api, DstNode: db}, time.Now())
+	assert.False(t, flagged)
+	v, flagged := e.Record(&graph.Connection{Src: "front", Dst: "db", SrcNode: front, DstNode: db, Violation: "no-front-to-data"}, time.Now())
+	assert.True(t, flagged)
+	assert.Equal(t, "no-front-to-data", v.Rule)
+}
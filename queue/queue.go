@@ -0,0 +1,307 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	LOG_FILE    = "queue.%d.log"
+	OFFSET_FILE = "queue.offset"
+	HEADER_SIZE = 8
+	MAX_RECORD  = 16 << 20
+	// COMPACT_OFFSET is the read offset past which the unread records are
+	// moved to a new log segment, so that a queue never drained stays small.
+	COMPACT_OFFSET = 16 << 20
+	// OFFSET_BATCH is the number of entries removed between two offset
+	// saves. After a crash, up to as many entries are read again.
+	OFFSET_BATCH = 100
+)
+
+var (
+	ErrFull  = errors.New("queue is full")
+	ErrEmpty = errors.New("queue is empty")
+)
+
+// Config bounds the queue by entries and by the bytes of the queued
+// entries. The log on disk stays under MaxBytes plus COMPACT_OFFSET.
+type Config struct {
+	Dir        string `json:"dir"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
+}
+
+// Queue is a bounded FIFO persisted on disk. Entries are appended to a log
+// segment as length and CRC prefixed records; the segment and the offset of
+// the first unread record are stored next to it so that a restart resumes
+// where the reader stopped. The unread records are moved to a new segment
+// whenever the queue is drained or the reader went past COMPACT_OFFSET.
+type Queue struct {
+	mu       sync.Mutex
+	dir      string
+	max      int
+	maxBytes int64
+	compact  int64
+	log      *os.File
+	segment  int64
+	read     int64
+	write    int64
+	length   int
+	unsaved  int
+}
+
+func DefaultConfig() Config {
+	return Config{MaxEntries: 100000, MaxBytes: 256 << 20}
+}
+
+func Open(c Config) (*Queue, error) {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: c.Dir, max: c.MaxEntries, maxBytes: c.MaxBytes, compact: COMPACT_OFFSET}
+	var err error
+	if q.segment, q.read, err = q.readOffset(); err != nil {
+		return nil, err
+	}
+	if q.log, err = os.OpenFile(q.path(q.segment), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, err
+	}
+	if err := q.recover(); err != nil {
+		q.log.Close()
+		return nil, err
+	}
+	q.removeSegments()
+	return q, nil
+}
+
+func (q *Queue) path(segment int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf(LOG_FILE, segment))
+}
+
+// removeSegments deletes the segments left by a crash during a compaction.
+func (q *Queue) removeSegments() {
+	files, _ := filepath.Glob(filepath.Join(q.dir, strings.Replace(LOG_FILE, "%d", "*", 1)))
+	for _, f := range files {
+		if f != q.path(q.segment) {
+			os.Remove(f)
+		}
+	}
+}
+
+// recover counts the entries left after the read offset and drops a record
+// torn by a crash during an append.
+func (q *Queue) recover() error {
+	info, err := q.log.Stat()
+	if err != nil {
+		return err
+	}
+	if q.read > info.Size() {
+		q.read = 0
+	}
+	offset := q.read
+	for {
+		_, next, err := q.record(offset)
+		if err != nil {
+			break
+		}
+		offset = next
+		q.length++
+	}
+	q.write = offset
+	return q.log.Truncate(offset)
+}
+
+// readOffset returns the segment and read offset stored as "segment offset".
+func (q *Queue) readOffset() (int64, int64, error) {
+	b, err := ioutil.ReadFile(filepath.Join(q.dir, OFFSET_FILE))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 {
+		return 0, 0, errors.New("malformed queue offset file")
+	}
+	segment, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	return segment, offset, err
+}
+
+// saveOffset replaces the offset file atomically and durably: a crash leaves
+// either the old or the new offset, never an empty file.
+func (q *Queue) saveOffset(segment, offset int64) error {
+	tmp := filepath.Join(q.dir, OFFSET_FILE+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d %d", segment, offset); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, OFFSET_FILE)); err != nil {
+		return err
+	}
+	// The rename only survives a crash once the directory is synced.
+	d, err := os.Open(q.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return err
+	}
+	q.unsaved = 0
+	return nil
+}
+
+// compactLog moves the unread records to a new segment. The offset file
+// switches to the new segment only once it is on disk, so that a crash
+// leaves one of the two segments complete.
+func (q *Queue) compactLog() error {
+	next := q.segment + 1
+	f, err := os.OpenFile(q.path(next), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.NewSectionReader(q.log, q.read, q.write-q.read))
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = q.saveOffset(next, 0)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(q.path(next))
+		return err
+	}
+	q.log.Close()
+	os.Remove(q.path(q.segment))
+	q.log = f
+	q.segment = next
+	q.write -= q.read
+	q.read = 0
+	return nil
+}
+
+func (q *Queue) record(offset int64) ([]byte, int64, error) {
+	header := make([]byte, HEADER_SIZE)
+	if _, err := q.log.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > MAX_RECORD {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, size)
+	if _, err := q.log.ReadAt(data, offset+HEADER_SIZE); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	return data, offset + HEADER_SIZE + int64(size), nil
+}
+
+func (q *Queue) Push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.max > 0 && q.length >= q.max {
+		return ErrFull
+	}
+	if len(data) > MAX_RECORD {
+		return errors.New("queue entry is too large")
+	}
+	if q.maxBytes > 0 && q.write-q.read+HEADER_SIZE+int64(len(data)) > q.maxBytes {
+		return ErrFull
+	}
+	b := make([]byte, HEADER_SIZE+len(data))
+	binary.BigEndian.PutUint32(b[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(b[4:HEADER_SIZE], crc32.ChecksumIEEE(data))
+	copy(b[HEADER_SIZE:], data)
+	if _, err := q.log.WriteAt(b, q.write); err != nil {
+		return err
+	}
+	if err := q.log.Sync(); err != nil {
+		return err
+	}
+	q.write += int64(len(b))
+	q.length++
+	return nil
+}
+
+// Peek returns the oldest entry without removing it.
+func (q *Queue) Peek() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.length == 0 {
+		return nil, ErrEmpty
+	}
+	data, _, err := q.record(q.read)
+	return data, err
+}
+
+// Pop removes the oldest entry. The read offset is saved every OFFSET_BATCH
+// entries and when the log is compacted, so entries are delivered at least
+// once.
+func (q *Queue) Pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.length == 0 {
+		return ErrEmpty
+	}
+	_, next, err := q.record(q.read)
+	if err != nil {
+		return err
+	}
+	q.length--
+	q.read = next
+	q.unsaved++
+	if q.length == 0 || q.read >= q.compact {
+		return q.compactLog()
+	}
+	if q.unsaved >= OFFSET_BATCH {
+		return q.saveOffset(q.segment, q.read)
+	}
+	return nil
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.unsaved > 0 {
+		if err := q.saveOffset(q.segment, q.read); err != nil {
+			q.log.Close()
+			return err
+		}
+	}
+	return q.log.Close()
+}
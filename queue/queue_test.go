@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempQueue(t *testing.T, max int) (*Queue, string) {
+	dir, err := ioutil.TempDir("", "queue_")
+	assert.Nil(t, err)
+	q, err := Open(Config{Dir: dir, MaxEntries: max})
+	assert.Nil(t, err)
+	return q, dir
+}
+
+func TestQueue_Order(t *testing.T) {
+	q, dir := tempQueue(t, 0)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, q.Push([]byte("first")))
+	assert.Nil(t, q.Push([]byte("second")))
+	assert.Equal(t, 2, q.Len())
+
+	b, err := q.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(b))
+	assert.Nil(t, q.Pop())
+	b, _ = q.Peek()
+	assert.Equal(t, "second", string(b))
+	assert.Nil(t, q.Pop())
+
+	_, err = q.Peek()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Equal(t, ErrEmpty, q.Pop())
+}
+
+func TestQueue_Full(t *testing.T) {
+	q, dir := tempQueue(t, 1)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, q.Push([]byte("first")))
+	assert.Equal(t, ErrFull, q.Push([]byte("second")))
+}
+
+func TestQueue_Reopen(t *testing.T) {
+	q, dir := tempQueue(t, 0)
+	defer os.RemoveAll(dir)
+	q.Push([]byte("first"))
+	q.Push([]byte("second"))
+	q.Push([]byte("third"))
+	q.Pop()
+	q.Close()
+
+	f, _ := os.OpenFile(filepath.Join(dir, fmt.Sprintf(LOG_FILE, 0)), os.O_APPEND|os.O_WRONLY, 0600)
+	f.Write([]byte{0, 0, 0, 42, 1})
+	f.Close()
+
+	q, err := Open(Config{Dir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, q.Len())
+	b, _ := q.Peek()
+	assert.Equal(t, "second", string(b))
+
+	assert.Nil(t, q.Push([]byte("fourth")))
+	q.Pop()
+	q.Pop()
+	b, _ = q.Peek()
+	assert.Equal(t, "fourth", string(b))
+}
+
+func TestQueue_Drained(t *testing.T) {
+	q, dir := tempQueue(t, 0)
+	defer os.RemoveAll(dir)
+	q.Push([]byte("first"))
+	q.Pop()
+
+	info, _ := os.Stat(filepath.Join(dir, fmt.Sprintf(LOG_FILE, 1)))
+	assert.Equal(t, int64(0), info.Size())
+	_, err := os.Stat(filepath.Join(dir, fmt.Sprintf(LOG_FILE, 0)))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestQueue_MaxBytes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "queue_")
+	defer os.RemoveAll(dir)
+	q, err := Open(Config{Dir: dir, MaxBytes: 2 * (HEADER_SIZE + 5)})
+	assert.Nil(t, err)
+
+	assert.Nil(t, q.Push([]byte("first")))
+	assert.Nil(t, q.Push([]byte("secnd")))
+	assert.Equal(t, ErrFull, q.Push([]byte("third")))
+	q.Pop()
+	assert.Nil(t, q.Push([]byte("third")))
+}
+
+func TestQueue_Compact(t *testing.T) {
+	q, dir := tempQueue(t, 0)
+	defer os.RemoveAll(dir)
+	q.compact = 3 * (HEADER_SIZE + 1)
+	for _, b := range "abcde" {
+		q.Push([]byte(string(b)))
+	}
+	for i := 0; i < 3; i++ {
+		q.Pop()
+	}
+
+	info, _ := os.Stat(filepath.Join(dir, fmt.Sprintf(LOG_FILE, 1)))
+	assert.Equal(t, int64(2*(HEADER_SIZE+1)), info.Size())
+	q.Close()
+
+	q, err := Open(Config{Dir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, q.Len())
+	b, _ := q.Peek()
+	assert.Equal(t, "d", string(b))
+}
+
+func TestQueue_OffsetBatch(t *testing.T) {
+	q, dir := tempQueue(t, 0)
+	defer os.RemoveAll(dir)
+	for i := 0; i < OFFSET_BATCH+2; i++ {
+		q.Push([]byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < OFFSET_BATCH+1; i++ {
+		q.Pop()
+	}
+
+	// Reopening without Close, as after a crash, resumes at the last save.
+	q, err := Open(Config{Dir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, q.Len())
+	b, _ := q.Peek()
+	assert.Equal(t, fmt.Sprint(OFFSET_BATCH), string(b))
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/metrics"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+)
+
+// GrpcLimiter limits the calls and the streamed messages of each agent. Its
+// interceptors must run after the agent authentication ones.
+type GrpcLimiter struct {
+	limiter *Limiter
+}
+
+func NewGrpcLimiter(c Config) *GrpcLimiter {
+	return &GrpcLimiter{limiter: NewLimiter(c.Grpc, c.Overrides)}
+}
+
+func grpcKey(ctx context.Context) string {
+	if a := auth.AgentFromContext(ctx); a != nil {
+		return a.Name
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func (g *GrpcLimiter) allow(ctx context.Context, method string) error {
+	key := grpcKey(ctx)
+	if g.limiter.Allow(key) {
+		return nil
+	}
+	metrics.RateLimited.WithLabelValues("grpc").Inc()
+	log.WithField("client", key).WithField("method", method).Debug("Rate limit exceeded")
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+}
+
+func (g *GrpcLimiter) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := g.allow(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type limitedStream struct {
+	grpc.ServerStream
+	limiter *GrpcLimiter
+	method  string
+}
+
+// RecvMsg takes a token for every message, ending the stream once the
+// agent runs out of them.
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.limiter.allow(s.Context(), s.method); err != nil {
+		return err
+	}
+	return s.ServerStream.RecvMsg(m)
+}
+
+func (g *GrpcLimiter) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &limitedStream{ServerStream: ss, limiter: g, method: info.FullMethod})
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/metrics"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// HttpLimiter limits the requests of each HTTP client. Authenticated clients
+// are keyed by principal name, the others, including those sending invalid
+// credentials, by address.
+type HttpLimiter struct {
+	limiter *Limiter
+	auth    *auth.Auth
+	retry   string
+	exempt  map[string]bool
+}
+
+// NewHttpLimiter authenticates the requests with a to key them. The
+// principal is kept in the request context for the handlers behind.
+// Requests to the exempt paths, such as probes, are never limited.
+func NewHttpLimiter(c Config, a *auth.Auth, exempt ...string) *HttpLimiter {
+	retry := 1
+	if c.Http.Rate > 0 {
+		retry = int(math.Ceil(1 / c.Http.Rate))
+	}
+	paths := make(map[string]bool, len(exempt))
+	for _, p := range exempt {
+		paths[p] = true
+	}
+	return &HttpLimiter{limiter: NewLimiter(c.Http, c.Overrides), auth: a, retry: strconv.Itoa(retry), exempt: paths}
+}
+
+func (l *HttpLimiter) key(r *http.Request) (string, *http.Request) {
+	if l.auth.Enabled() {
+		if p, err := l.auth.Authenticate(r); err == nil {
+			return "principal:" + p.Name, r.WithContext(auth.WithPrincipal(r.Context(), p))
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host, r
+	}
+	return r.RemoteAddr, r
+}
+
+func (l *HttpLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.exempt[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key, r := l.key(r)
+		if !l.limiter.Allow(key) {
+			metrics.RateLimited.WithLabelValues("http").Inc()
+			log.WithField("client", key).WithField("path", r.URL.Path).Debug("Rate limit exceeded")
+			w.Header().Set("Retry-After", l.retry)
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"docker-visualizer/aggregator/logging"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+var log = logging.For("ratelimit")
+
+const (
+	IDLE_TIMEOUT   = 10 * time.Minute
+	SWEEP_INTERVAL = time.Minute
+)
+
+// Limit is a token bucket: Rate tokens per second, up to Burst at once.
+// A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Config sets the limits of agents on gRPC, keyed by agent name (or peer
+// address when agents are not authenticated), and of HTTP clients, keyed
+// by "principal:<name>" or client address. Overrides replace the limit of a given key.
+type Config struct {
+	Grpc      Limit            `json:"grpc"`
+	Http      Limit            `json:"http"`
+	Overrides map[string]Limit `json:"overrides"`
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// Limiter keeps one token bucket per key. Buckets idle for IDLE_TIMEOUT are
+// forgotten so that short lived clients do not accumulate.
+type Limiter struct {
+	limit     Limit
+	overrides map[string]Limit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	swept     time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Grpc: Limit{Rate: 1000, Burst: 2000},
+		Http: Limit{Rate: 10, Burst: 20},
+	}
+}
+
+func NewLimiter(limit Limit, overrides map[string]Limit) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		overrides: overrides,
+		buckets:   make(map[string]*bucket),
+		swept:     time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key.
+func (l *Limiter) Allow(key string) bool {
+	limit, ok := l.overrides[key]
+	if !ok {
+		limit = l.limit
+	}
+	if limit.Rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > SWEEP_INTERVAL {
+		for k, b := range l.buckets {
+			if now.Sub(b.seen) > IDLE_TIMEOUT {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), burst)}
+		l.buckets[key] = b
+	}
+	b.seen = now
+	return b.limiter.AllowN(now, 1)
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 1, Burst: 2}, map[string]Limit{"vip": {Rate: 0}})
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"))
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Allow("vip"))
+	}
+}
+
+func TestGrpcLimiter(t *testing.T) {
+	g := NewGrpcLimiter(Config{Grpc: Limit{Rate: 1, Burst: 1}})
+	info := &grpc.UnaryServerInfo{FullMethod: auth.AGENT_SERVICE + "AddNode"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	one := auth.WithAgent(context.Background(), &auth.Agent{Name: "one"})
+	two := auth.WithAgent(context.Background(), &auth.Agent{Name: "two"})
+
+	_, err := g.UnaryServerInterceptor(one, nil, info, handler)
+	assert.Nil(t, err)
+	_, err = g.UnaryServerInterceptor(one, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = g.UnaryServerInterceptor(two, nil, info, handler)
+	assert.Nil(t, err)
+}
+
+func TestHttpLimiter(t *testing.T) {
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	l := NewHttpLimiter(Config{Http: Limit{Rate: 0.5, Burst: 1}}, a, "/healthz")
+	var principal *auth.Principal
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = auth.FromContext(r.Context())
+	}))
+
+	servePath := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	serve := func(token string) *httptest.ResponseRecorder {
+		return servePath("/topology/front", token)
+	}
+
+	assert.Equal(t, http.StatusOK, serve("").Code)
+	w := serve("")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("secret").Code)
+	assert.Equal(t, "ui", principal.Name)
+	assert.Equal(t, http.StatusTooManyRequests, serve("secret").Code)
+
+	// Invalid tokens share the bucket of the client address.
+	assert.Equal(t, http.StatusTooManyRequests, serve("bogus-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("bogus-2").Code)
+
+	// Exempt paths are served whatever the bucket.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, servePath("/healthz", "").Code)
+	}
+}
@@ -0,0 +1,274 @@
+package rest
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/graph"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	MAX_PATHS = 10
+)
+
+// hotspotOrders are the rankings of the hotspots endpoint, besides the
+// default one by betweenness.
+var hotspotOrders = map[string]func(a, b *graph.Hotspot) bool{
+	"in":      func(a, b *graph.Hotspot) bool { return a.InDegree > b.InDegree },
+	"out":     func(a, b *graph.Hotspot) bool { return a.OutDegree > b.OutDegree },
+	"traffic": func(a, b *graph.Hotspot) bool { return a.Bytes > b.Bytes },
+}
+
+// depth reads the optional depth query parameter, 0 meaning unbounded.
+func depth(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("depth")
+	if v == "" {
+		return 0, true
+	}
+	d, err := strconv.Atoi(v)
+	return d, err == nil && d >= 0
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithField("error", err).Error("Error while encoding response")
+	}
+}
+
+// analysisError answers the error of a graph analysis and reports whether
+// there was one.
+func analysisError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case graph.ErrNodeNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return true
+}
+
+// visible keeps the nodes of a closure the caller may read. Paths going
+// through hidden stacks are kept as is: they only reveal container ids.
+func visible(p *auth.Principal, c *graph.Closure) *graph.Closure {
+	nodes := make([]graph.Reached, 0, len(c.Nodes))
+	for _, r := range c.Nodes {
+		if p.Allowed(r.Node.Stack) {
+			nodes = append(nodes, r)
+		}
+	}
+	return &graph.Closure{Origin: c.Origin, Nodes: nodes}
+}
+
+func (h *Handler) closure(d graph.Direction) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		maxDepth, ok := depth(r)
+		if !ok {
+			http.Error(w, "depth must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		t, err := h.graph.FindTopology("")
+		if analysisError(w, err) {
+			return
+		}
+		c, err := t.Closure(params.ByName("id"), d, maxDepth)
+		if analysisError(w, err) {
+			return
+		}
+		p := auth.FromContext(r.Context())
+		if !p.Allowed(c.Origin.Stack) {
+			http.Error(w, "access to stack "+c.Origin.Stack+" denied", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, visible(p, c))
+	}
+}
+
+func (h *Handler) fetchDependencies(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h.closure(graph.Downstream)(w, r, params)
+}
+
+func (h *Handler) fetchDependents(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h.closure(graph.Upstream)(w, r, params)
+}
+
+func (h *Handler) fetchBlastRadius(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	d, ok := depth(r)
+	if !ok {
+		http.Error(w, "depth must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	t, err := h.graph.FindTopology("")
+	if analysisError(w, err) {
+		return
+	}
+	b, err := t.BlastRadius(params.ByName("id"), d)
+	if analysisError(w, err) {
+		return
+	}
+	p := auth.FromContext(r.Context())
+	if !p.Allowed(b.Origin.Stack) {
+		http.Error(w, "access to stack "+b.Origin.Stack+" denied", http.StatusForbidden)
+		return
+	}
+	services := make([]graph.ImpactedService, 0, len(b.Services))
+	for _, s := range b.Services {
+		if p.Allowed(s.Stack) {
+			services = append(services, s)
+		}
+	}
+	writeJSON(w, &graph.BlastRadius{Origin: b.Origin, Services: services})
+}
+
+func nodesVisible(p *auth.Principal, nodes []graph.Node) bool {
+	for _, n := range nodes {
+		if !p.Allowed(n.Stack) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchPaths answers the routes between the from and to containers. Paths
+// crossing a stack the caller may not read are left out.
+func (h *Handler) fetchPaths(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" || to == "" {
+		http.Error(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+	max := 0
+	if v := q.Get("max"); v != "" {
+		var err error
+		if max, err = strconv.Atoi(v); err != nil || max < 0 || max > MAX_PATHS {
+			http.Error(w, "max must be between 0 and "+strconv.Itoa(MAX_PATHS), http.StatusBadRequest)
+			return
+		}
+	}
+	t, err := h.graph.FindTopology("")
+	if analysisError(w, err) {
+		return
+	}
+	paths, err := t.Paths(from, to, max, graph.Weight(q.Get("weight")))
+	if err == graph.ErrUnknownWeight {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if analysisError(w, err) {
+		return
+	}
+	p := auth.FromContext(r.Context())
+	for _, stack := range []string{paths.From.Stack, paths.To.Stack} {
+		if !p.Allowed(stack) {
+			http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+			return
+		}
+	}
+	all := paths.Alternatives
+	if paths.Shortest != nil {
+		all = append([]graph.Path{*paths.Shortest}, all...)
+	}
+	result := &graph.Paths{From: paths.From, To: paths.To, Weight: paths.Weight, Alternatives: make([]graph.Path, 0)}
+	for i := range all {
+		if !nodesVisible(p, all[i].Nodes) {
+			continue
+		}
+		if result.Shortest == nil {
+			result.Shortest = &all[i]
+		} else {
+			result.Alternatives = append(result.Alternatives, all[i])
+		}
+	}
+	writeJSON(w, result)
+}
+
+// fetchCycles answers the cycles of a stack, or of the whole cluster when
+// no stack is given. Components crossing a hidden stack are left out.
+func (h *Handler) fetchCycles(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	stack := r.URL.Query().Get("stack")
+	p := auth.FromContext(r.Context())
+	if stack != "" && !p.Allowed(stack) {
+		http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+		return
+	}
+	t, err := h.graph.FindTopology(stack)
+	if analysisError(w, err) {
+		return
+	}
+	components := t.Components(stack)
+	result := make([]graph.Component, 0, len(components))
+	for _, c := range components {
+		if nodesVisible(p, c.Nodes) {
+			result = append(result, c)
+		}
+	}
+	writeJSON(w, result)
+}
+
+// fetchHotspots ranks the containers of a stack, or of the stacks the caller
+// may read. The sort parameter picks the ranking and limit truncates it.
+func (h *Handler) fetchHotspots(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	stack := q.Get("stack")
+	p := auth.FromContext(r.Context())
+	if stack != "" && !p.Allowed(stack) {
+		http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+		return
+	}
+	less, ok := hotspotOrders[q.Get("sort")]
+	if !ok && q.Get("sort") != "" && q.Get("sort") != "betweenness" {
+		http.Error(w, "sort must be one of betweenness, in, out or traffic", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	t, err := h.graph.FindTopology(stack)
+	if analysisError(w, err) {
+		return
+	}
+	hotspots := t.Hotspots()
+	result := make([]graph.Hotspot, 0, len(hotspots))
+	for _, hs := range hotspots {
+		if p.Allowed(hs.Node.Stack) {
+			result = append(result, hs)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(result, func(i, j int) bool { return less(&result[i], &result[j]) })
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	writeJSON(w, result)
+}
+
+// fetchView answers the topology of a stack with its containers grouped by
+// service, host or network.
+func (h *Handler) fetchView(w http.ResponseWriter, stack string, v graph.View) {
+	t, err := h.graph.FindTopology(stack)
+	if analysisError(w, err) {
+		return
+	}
+	a, err := t.Aggregate(v)
+	if err == graph.ErrUnknownView {
+		http.Error(w, "view must be one of container, service, host or network", http.StatusBadRequest)
+		return
+	}
+	if analysisError(w, err) {
+		return
+	}
+	writeJSON(w, a)
+}
@@ -1,45 +1,175 @@
 package rest
 
 import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/compose"
 	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/netpolicy"
+	"encoding/json"
 	"github.com/julienschmidt/httprouter"
-	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mime"
 	"net/http"
 )
 
+var log = logging.For("rest")
+
 type Handler struct {
 	graph graph.IGraph
 }
 
 type RestServer struct {
-	router *httprouter.Router
+	router  *httprouter.Router
+	handler http.Handler
 }
 
 type IRestServer interface {
 	Listen()
 	GetRouter() *httprouter.Router
+	Use(middleware func(http.Handler) http.Handler)
 }
 
 func (h *Handler) fetchTopologyByStack(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-	resp, err := h.graph.FindByStack(params.ByName("stack"))
+	stack := params.ByName("stack")
+	if !auth.FromContext(r.Context()).Allowed(stack) {
+		http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+		return
+	}
+	if view := r.URL.Query().Get("view"); view != "" && view != "container" {
+		h.fetchView(w, stack, graph.View(view))
+		return
+	}
+	resp, err := h.graph.FindByStack(stack)
 	if err != nil {
 		log.Error(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Write(resp)
 }
 
-func NewRestServer(graph graph.IGraph) IRestServer {
+// readable keeps the nodes of a topology in stacks the caller may read.
+// Edges are kept: the ones reaching a hidden node only reveal its id.
+func readable(p *auth.Principal, t *graph.Topology) *graph.Topology {
+	nodes := make([]graph.Node, 0, len(t.Nodes))
+	for _, n := range t.Nodes {
+		if p.Allowed(n.Stack) {
+			nodes = append(nodes, n)
+		}
+	}
+	return &graph.Topology{Nodes: nodes, Edges: t.Edges}
+}
+
+// fetchStackPolicy generates the allow-lists of a stack from its observed
+// edges, as Kubernetes network policies by default. Peers in stacks the
+// caller cannot read are left out of the allow-lists.
+func (h *Handler) fetchStackPolicy(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	stack := params.ByName("stack")
+	p := auth.FromContext(r.Context())
+	if !p.Allowed(stack) {
+		http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = netpolicy.FORMAT_KUBERNETES
+	}
+	t, err := h.graph.FindTopology("")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := netpolicy.Generate(readable(p, t), stack, format)
+	if err == netpolicy.ErrUnknownFormat {
+		http.Error(w, "format must be one of kubernetes, docker or iptables", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == netpolicy.FORMAT_IPTABLES {
+		w.Header().Set("Content-Type", "text/plain")
+	} else {
+		w.Header().Set("Content-Type", "application/yaml")
+	}
+	w.Write(b)
+}
+
+// MAX_EXPECTED_SIZE bounds the expected topologies uploaded for comparison.
+const MAX_EXPECTED_SIZE = 1 << 20
+
+// compareTopology diffs a stack against the expected topology in the body:
+// a docker-compose file when sent as YAML, an earlier GET /topology/:stack
+// export or a topology otherwise.
+func (h *Handler) compareTopology(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	stack := params.ByName("stack")
+	if !auth.FromContext(r.Context()).Allowed(stack) {
+		http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_EXPECTED_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var expected *graph.Topology
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		expected, err = compose.Parse(body, stack)
+	default:
+		var probe struct {
+			Find json.RawMessage `json:"find"`
+		}
+		if err = json.Unmarshal(body, &probe); err == nil && probe.Find != nil {
+			expected, err = graph.ParseExport(body, stack)
+		} else if err == nil {
+			expected = &graph.Topology{}
+			err = json.Unmarshal(body, expected)
+		}
+	}
+	if err != nil {
+		http.Error(w, "invalid expected topology: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := h.graph.FindTopology(stack)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, t.Compare(expected))
+}
+
+// NewRestServer serves the topology queries, authenticated by a. A nil a
+// disables authentication.
+func NewRestServer(graph graph.IGraph, a *auth.Auth) IRestServer {
 	router := httprouter.New()
 	h := &Handler{graph: graph}
-	router.GET("/topology/:stack", h.fetchTopologyByStack)
-	return &RestServer{router: router}
+	router.GET("/topology/:stack", a.Wrap(h.fetchTopologyByStack))
+	router.GET("/topology/:stack/policy", a.Wrap(h.fetchStackPolicy))
+	router.POST("/topology/:stack/compare", a.Wrap(h.compareTopology))
+	router.GET("/nodes/:id/dependencies", a.Wrap(h.fetchDependencies))
+	router.GET("/nodes/:id/dependents", a.Wrap(h.fetchDependents))
+	router.GET("/nodes/:id/blast-radius", a.Wrap(h.fetchBlastRadius))
+	router.GET("/paths", a.Wrap(h.fetchPaths))
+	router.GET("/analysis/cycles", a.Wrap(h.fetchCycles))
+	router.GET("/analysis/hotspots", a.Wrap(h.fetchHotspots))
+	return &RestServer{router: router, handler: router}
+}
+
+// Use wraps every route of the server, including the ones registered later
+// on the router, in a middleware. The last middleware added runs first.
+func (s *RestServer) Use(middleware func(http.Handler) http.Handler) {
+	s.handler = middleware(s.handler)
 }
 
 func (s *RestServer) Listen() {
-	log.Fatal(http.ListenAndServe(":8081", s.router))
+	log.Fatal(http.ListenAndServe(":8081", s.handler))
 }
 
 func (s *RestServer) GetRouter() *httprouter.Router {
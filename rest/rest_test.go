@@ -1,14 +1,18 @@
 package rest
 
 import (
+	"docker-visualizer/aggregator/auth"
 	"docker-visualizer/aggregator/graph"
 	pb "docker-visualizer/proto/containers"
+	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 type graphMock struct {
@@ -20,6 +24,11 @@ func (m *graphMock) InitializedSchema() error {
 	return args.Error(0)
 }
 
+func (m *graphMock) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *graphMock) ExistID(id string) (bool, error) {
 	args := m.Called(id)
 	return args.Bool(0), args.Error(1)
@@ -35,13 +44,23 @@ func (m *graphMock) DeleteNode(id string) error {
 	return args.Error(0)
 }
 
-func (m *graphMock) InsertNode(info *pb.ContainerInfo) error {
-	args := m.Called(info)
+func (m *graphMock) InsertNode(info *pb.ContainerInfo, agent string) error {
+	args := m.Called(info, agent)
 	return args.Error(0)
 }
 
-func (m *graphMock) Connect(event *pb.ContainerEvent) (*graph.Connection, error) {
-	args := m.Called(event)
+func (m *graphMock) UpdateNode(info *pb.ContainerInfo, agent string) error {
+	args := m.Called(info, agent)
+	return args.Error(0)
+}
+
+func (m *graphMock) ExpireEdges(before time.Time) ([]graph.Connection, error) {
+	args := m.Called(before)
+	return args.Get(0).([]graph.Connection), args.Error(1)
+}
+
+func (m *graphMock) Connect(event *pb.ContainerEvent, agent string, check graph.EdgeCheck) (*graph.Connection, error) {
+	args := m.Called(event, agent)
 	return args.Get(0).(*graph.Connection), args.Error(1)
 }
 
@@ -60,12 +79,22 @@ func (m *graphMock) FindByStack(stack string) (nodes []byte, err error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *graphMock) FindNode(id string) (*graph.Node, error) {
+	args := m.Called(id)
+	return args.Get(0).(*graph.Node), args.Error(1)
+}
+
+func (m *graphMock) FindTopology(stack string) (*graph.Topology, error) {
+	args := m.Called(stack)
+	return args.Get(0).(*graph.Topology), args.Error(1)
+}
+
 func (m *graphMock) Close() {
 	m.Called()
 }
 
 func TestNewRestServer(t *testing.T) {
-	server := NewRestServer(&graphMock{})
+	server := NewRestServer(&graphMock{}, nil)
 	assert.NotNil(t, server)
 }
 
@@ -74,7 +103,7 @@ func TestFetchTopologyOK(t *testing.T) {
 	b := []byte("123")
 	m.On("FindByStack", "toto").Return(b, nil)
 
-	server := NewRestServer(&m)
+	server := NewRestServer(&m, nil)
 	w := httptest.NewRecorder()
 
 	req, _ := http.NewRequest("GET", "/topology/toto", nil)
@@ -92,7 +121,7 @@ func TestFetchTopology500(t *testing.T) {
 	m := graphMock{}
 	m.On("FindByStack", "toto").Return([]byte{}, errors.New("custom error"))
 
-	server := NewRestServer(&m)
+	server := NewRestServer(&m, nil)
 
 	req, _ := http.NewRequest("GET", "/topology/toto", nil)
 	w := httptest.NewRecorder()
@@ -100,4 +129,316 @@ func TestFetchTopology500(t *testing.T) {
 
 	assert.Equal(t, 500, w.Code)
 	assert.Contains(t, w.Body.String(), "custom error")
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestFetchTopologyAuthorization(t *testing.T) {
+	m := graphMock{}
+	m.On("FindByStack", "toto").Return([]byte("123"), nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"toto"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/topology/toto", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+
+	req, _ = http.NewRequest("GET", "/topology/titi", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+
+	req, _ = http.NewRequest("GET", "/topology/toto", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	m.AssertNumberOfCalls(t, "FindByStack", 1)
+}
+
+func TestUse(t *testing.T) {
+	m := graphMock{}
+	m.On("FindByStack", "toto").Return([]byte("123"), nil)
+	server := NewRestServer(&m, nil)
+	server.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "wrapped")
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	req, _ := http.NewRequest("GET", "/topology/toto", nil)
+	w := httptest.NewRecorder()
+	server.(*RestServer).handler.ServeHTTP(w, req)
+	assert.Equal(t, "wrapped", w.Header().Get("X-Test"))
+	assert.Equal(t, "123", w.Body.String())
+}
+
+func TestFetchDependencies(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "api", Stack: "web"}, {Id: "db", Stack: "data"}, {Id: "front", Stack: "web"}, {Id: "cdn", Stack: "web"}},
+		Edges: []graph.Edge{{Src: "api", Dst: "db"}, {Src: "api", Dst: "front"}, {Src: "front", Dst: "cdn"}},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/nodes/api/dependencies?depth=2", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"cdn"`)
+	assert.NotContains(t, w.Body.String(), `"db"`)
+
+	req, _ = http.NewRequest("GET", "/nodes/cdn/dependents?depth=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"front"`)
+	assert.NotContains(t, w.Body.String(), `"api"`)
+
+	req, _ = http.NewRequest("GET", "/nodes/nope/dependencies", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	req, _ = http.NewRequest("GET", "/nodes/api/dependencies?depth=-1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestFetchBlastRadiusForbidden(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "api", Stack: "web"}, {Id: "db", Stack: "data"}},
+		Edges: []graph.Edge{{Src: "api", Dst: "db"}},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/nodes/db/blast-radius", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+}
+
+func TestFetchPaths(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "web"}, {Id: "p", Stack: "infra"}, {Id: "b", Stack: "web"}, {Id: "x", Stack: "web"}, {Id: "y", Stack: "web"}},
+		Edges: []graph.Edge{
+			{Src: "a", Dst: "p", Packets: 100}, {Src: "p", Dst: "b", Packets: 100},
+			{Src: "a", Dst: "x"}, {Src: "x", Dst: "y"}, {Src: "y", Dst: "b"},
+		},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/paths?from=a&to=b&max=2&weight=traffic", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"hops":3`)
+	assert.NotContains(t, w.Body.String(), `"infra"`)
+
+	req, _ = http.NewRequest("GET", "/paths?from=a", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestFetchCycles(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "web"}, {Id: "b", Stack: "web"}, {Id: "c", Stack: "web"}, {Id: "d", Stack: "data"}},
+		Edges: []graph.Edge{{Src: "a", Dst: "b"}, {Src: "b", Dst: "a"}, {Src: "c", Dst: "d"}, {Src: "d", Dst: "c"}},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/analysis/cycles", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"a"`)
+	assert.NotContains(t, w.Body.String(), `"data"`)
+
+	req, _ = http.NewRequest("GET", "/analysis/cycles?stack=data", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+}
+
+func TestFetchHotspots(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "front", Stack: "web"}, {Id: "gw", Stack: "web"}, {Id: "api", Stack: "web"}, {Id: "db", Stack: "data"}},
+		Edges: []graph.Edge{{Src: "front", Dst: "gw"}, {Src: "gw", Dst: "api"}, {Src: "front", Dst: "api"}, {Src: "db", Dst: "api"}},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/analysis/hotspots?sort=in&limit=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"api"`)
+	assert.NotContains(t, w.Body.String(), `"gw"`)
+	assert.NotContains(t, w.Body.String(), `"db"`)
+
+	req, _ = http.NewRequest("GET", "/analysis/hotspots?sort=weird", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestFetchTopologyView(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "toto").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "toto", Service: "api"}, {Id: "b", Stack: "toto", Service: "api"}},
+	}, nil)
+	server := NewRestServer(&m, nil)
+
+	req, _ := http.NewRequest("GET", "/topology/toto?view=service", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"toto/api"`)
+	m.AssertNotCalled(t, "FindByStack", "toto")
+
+	req, _ = http.NewRequest("GET", "/topology/toto?view=pod", nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestFetchStackPolicy(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a", Stack: "toto", Service: "api", Ip: "10.0.0.1"}},
+	}, nil)
+	server := NewRestServer(&m, nil)
+
+	req, _ := http.NewRequest("GET", "/topology/toto/policy", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "kind: NetworkPolicy")
+
+	req, _ = http.NewRequest("GET", "/topology/toto/policy?format=iptables", nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), "-A AGG-TOTO -d 10.0.0.1/32 -j DROP")
+
+	req, _ = http.NewRequest("GET", "/topology/toto/policy?format=pf", nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestFetchStackPolicyHiddenPeers(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "").Return(&graph.Topology{
+		Nodes: []graph.Node{
+			{Id: "a", Stack: "web", Service: "api", Ip: "10.0.0.1"},
+			{Id: "b", Stack: "billing", Service: "ledger", Ip: "10.0.0.2"},
+		},
+		Edges: []graph.Edge{{Src: "b", Dst: "a"}},
+	}, nil)
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	server := NewRestServer(&m, a)
+
+	req, _ := http.NewRequest("GET", "/topology/web/policy?format=iptables", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "10.0.0.2")
+
+	req, _ = http.NewRequest("GET", "/topology/web/policy", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "billing")
+	assert.NotContains(t, w.Body.String(), "ledger")
+}
+
+func TestCompareTopology(t *testing.T) {
+	m := graphMock{}
+	m.On("FindTopology", "toto").Return(&graph.Topology{
+		Nodes: []graph.Node{
+			{Id: "a", Stack: "toto", Service: "api"},
+			{Id: "b", Stack: "toto", Service: "db"},
+			{Id: "c", Stack: "toto", Service: "cache"},
+		},
+		Edges: []graph.Edge{{Src: "a", Dst: "b"}, {Src: "a", Dst: "c"}},
+	}, nil)
+	server := NewRestServer(&m, nil)
+
+	body := "services:\n  api:\n    depends_on: [db, queue]\n  db: {}\n  queue: {}\n"
+	req, _ := http.NewRequest("POST", "/topology/toto/compare", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/yaml")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var d graph.Diff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.False(t, d.Match)
+	assert.Equal(t, []graph.ServiceEdge{{Src: "api", Dst: "cache"}}, d.UnexpectedEdges)
+	assert.Equal(t, []graph.ServiceEdge{{Src: "api", Dst: "queue"}}, d.MissingEdges)
+	assert.Equal(t, []string{"queue"}, d.AbsentContainers)
+	assert.Len(t, d.UnknownContainers, 1)
+	assert.Equal(t, "c", d.UnknownContainers[0].Id)
+
+	req, _ = http.NewRequest("POST", "/topology/toto/compare", strings.NewReader("{nope"))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestCompareTopologyExport(t *testing.T) {
+	m := graphMock{}
+	export := `{"find":[
+		{"uid":"0x1","id":"a","name":"api_1","stack":"toto","service":"api","connected":[
+			{"uid":"0x2","id":"b","name":"db_1","stack":"toto","service":"db","parent":[{"uid":"0x1"}]},
+			{"uid":"0x9","id":"z","name":"auth_1","stack":"shared","service":"auth"}
+		]},
+		{"uid":"0x2","id":"b","name":"db_1","stack":"toto","service":"db","parent":[{"uid":"0x1","id":"a"}]}
+	]}`
+	m.On("FindByStack", "toto").Return([]byte(export), nil)
+	m.On("FindTopology", "toto").Return(&graph.Topology{
+		Nodes: []graph.Node{{Id: "a2", Stack: "toto", Service: "api"}, {Id: "b2", Stack: "toto", Service: "db"}},
+		Edges: []graph.Edge{{Src: "a2", Dst: "b2"}, {Src: "a2", Dst: "z"}},
+	}, nil)
+	server := NewRestServer(&m, nil)
+
+	req, _ := http.NewRequest("GET", "/topology/toto", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	req, _ = http.NewRequest("POST", "/topology/toto/compare", w.Body)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var d graph.Diff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.True(t, d.Match)
 }
@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"sync"
+)
+
+type Message struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+// MemoryBroker is an in-process broker keeping every published message.
+// It stands in for a real broker in tests and local runs.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (m *MemoryBroker) Publish(topic, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, Message{Topic: topic, Key: key, Value: value})
+	return nil
+}
+
+func (m *MemoryBroker) Close() error {
+	return nil
+}
+
+// Fail makes every following publish return err, until called with nil.
+func (m *MemoryBroker) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *MemoryBroker) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NATS_DIAL_TIMEOUT  = 5 * time.Second
+	NATS_WRITE_TIMEOUT = 5 * time.Second
+)
+
+// natsPublisher speaks the NATS text protocol. Messages are published on the
+// subject "<topic>.<key>". The connection is opened on the first publish and
+// redialed after a failure. Writes give up after the write timeout so that a
+// stalled server cannot block the sink.
+type natsPublisher struct {
+	addr    string
+	timeout time.Duration
+	mu      sync.Mutex
+	conn    net.Conn
+	w       *bufio.Writer
+}
+
+func NewNatsPublisher(addr string) Publisher {
+	return &natsPublisher{addr: addr, timeout: NATS_WRITE_TIMEOUT}
+}
+
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, NATS_DIAL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(NATS_DIAL_TIMEOUT))
+	r := bufio.NewReader(conn)
+	info, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(info, "INFO") {
+		conn.Close()
+		return fmt.Errorf("unexpected nats greeting %q", strings.TrimSpace(info))
+	}
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"aggregator\"}\r\n"); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	p.conn = conn
+	p.w = w
+	go p.read(conn, r)
+	return nil
+}
+
+// read answers server pings and reports protocol errors until the connection closes.
+func (p *natsPublisher) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			if p.conn == conn {
+				p.w.WriteString("PONG\r\n")
+				p.flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.WithField("error", strings.TrimSpace(line)).Error("Nats server error")
+		}
+	}
+}
+
+func (p *natsPublisher) flush() error {
+	p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	return p.w.Flush()
+}
+
+// Publish redials once when the connection fails, as it may just have been
+// closed by the server.
+func (p *natsPublisher) Publish(topic, key string, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for retried := false; ; retried = true {
+		if p.conn == nil {
+			if err := p.connect(); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(p.w, "PUB %s.%s %d\r\n", topic, subjectToken(key), len(value))
+		p.w.Write(value)
+		p.w.WriteString("\r\n")
+		err := p.flush()
+		if err == nil {
+			return nil
+		}
+		p.conn.Close()
+		p.conn = nil
+		if retried {
+			return err
+		}
+		log.WithField("error", err).Warn("Nats connection failed, reconnecting")
+	}
+}
+
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// subjectToken makes a key usable as a single NATS subject token.
+func subjectToken(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '*' || r == '>' || r == ' ' || r == '\t' {
+			return '_'
+		}
+		return r
+	}, key)
+}
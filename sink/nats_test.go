@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNatsPublisher(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	lines := make(chan string, 3)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(conn)
+		for i := 0; i < 3; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+
+	p, err := NewPublisher("nats://" + l.Addr().String())
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Nil(t, p.Publish("topology", "my.stack", []byte("hello")))
+
+	assert.True(t, strings.HasPrefix(<-lines, "CONNECT"))
+	assert.Equal(t, "PUB topology.my_stack 5", <-lines)
+	assert.Equal(t, "hello", <-lines)
+}
+
+func TestNewPublisher(t *testing.T) {
+	_, err := NewPublisher("kafka://localhost:9092")
+	assert.NotNil(t, err)
+}
+
+func TestNatsPublisherStalled(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		// Greet, then never read nor accept again.
+		l.Close()
+		conn.Write([]byte("INFO {}\r\n"))
+		accepted <- conn
+	}()
+
+	p := &natsPublisher{addr: l.Addr().String(), timeout: 50 * time.Millisecond}
+	defer p.Close()
+	done := make(chan error)
+	go func() {
+		value := make([]byte, 1<<20)
+		for {
+			if err := p.Publish("topology", "stack", value); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a stalled server")
+	}
+	(<-accepted).Close()
+}
@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/events"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"strings"
+	"sync/atomic"
+)
+
+var log = logging.For("sink")
+
+const (
+	FORMAT_JSON     = "json"
+	FORMAT_PROTOBUF = "protobuf"
+)
+
+// Publisher sends a message to a topic of a message broker. The key groups
+// related messages, like a Kafka partition key or a NATS subject token.
+type Publisher interface {
+	Publish(topic, key string, value []byte) error
+	Close() error
+}
+
+type Config struct {
+	Url    string `json:"url"`
+	Topic  string `json:"topic"`
+	Format string `json:"format"`
+	Buffer int    `json:"buffer"`
+}
+
+type Sink struct {
+	publisher Publisher
+	config    Config
+	published uint64
+	failures  uint64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Topic:  "topology",
+		Format: FORMAT_JSON,
+		Buffer: 1024,
+	}
+}
+
+// NewPublisher returns the publisher for a broker url. Only nats:// urls are supported.
+func NewPublisher(url string) (Publisher, error) {
+	if strings.HasPrefix(url, "nats://") {
+		return NewNatsPublisher(strings.TrimPrefix(url, "nats://")), nil
+	}
+	return nil, errors.New("unsupported message broker url " + url)
+}
+
+func New(publisher Publisher, config Config) (*Sink, error) {
+	if config.Format != FORMAT_JSON && config.Format != FORMAT_PROTOBUF {
+		return nil, errors.New("unsupported sink format " + config.Format)
+	}
+	return &Sink{publisher: publisher, config: config}, nil
+}
+
+// Run publishes every bus event. Events are dropped rather than blocking
+// ingestion when the broker cannot keep up.
+func (s *Sink) Run(b *bus.Bus) {
+	sub := b.Subscribe("sink", s.config.Buffer, bus.DropNewest)
+	defer sub.Close()
+	for e := range sub.Events() {
+		s.publish(e)
+	}
+}
+
+func (s *Sink) publish(e bus.Event) {
+	value, err := s.encode(e)
+	if err != nil {
+		atomic.AddUint64(&s.failures, 1)
+		metrics.SinkFailures.Inc()
+		log.WithField("error", err).Error("Error while encoding sink event")
+		return
+	}
+	if value == nil {
+		return
+	}
+	if err := s.publisher.Publish(s.config.Topic, stackOf(e), value); err != nil {
+		atomic.AddUint64(&s.failures, 1)
+		metrics.SinkFailures.Inc()
+		log.WithField("topic", s.config.Topic).WithField("error", err).Error("Error while publishing event")
+		return
+	}
+	atomic.AddUint64(&s.published, 1)
+}
+
+func (s *Sink) encode(e bus.Event) ([]byte, error) {
+	if s.config.Format == FORMAT_PROTOBUF {
+		event := events.NewTopologyEvent(e)
+		if event.Type == events.EventType_UNKNOWN {
+			return nil, nil
+		}
+		return proto.Marshal(event)
+	}
+	return e.MarshalClientEvent()
+}
+
+func (s *Sink) Published() uint64 {
+	return atomic.LoadUint64(&s.published)
+}
+
+func (s *Sink) Failures() uint64 {
+	return atomic.LoadUint64(&s.failures)
+}
+
+// stackOf keys an event by the stack of its node, or of the edge source.
+func stackOf(e bus.Event) string {
+	for _, n := range e.Nodes() {
+		if n != nil && n.Stack != "" {
+			return n.Stack
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/events"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/metrics"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(NewMemoryBroker(), Config{Format: "xml"})
+	assert.NotNil(t, err)
+}
+
+func TestSink_PublishJSON(t *testing.T) {
+	broker := NewMemoryBroker()
+	s, _ := New(broker, DefaultConfig())
+
+	s.publish(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "1", Stack: "front"}})
+	s.publish(bus.Event{Type: bus.EventType("UNKNOWN")})
+
+	m := broker.Messages()
+	assert.Len(t, m, 1)
+	assert.Equal(t, "topology", m[0].Topic)
+	assert.Equal(t, "front", m[0].Key)
+	assert.Contains(t, string(m[0].Value), `"action":"ADD"`)
+	assert.Equal(t, uint64(1), s.Published())
+}
+
+func TestSink_PublishProtobuf(t *testing.T) {
+	broker := NewMemoryBroker()
+	c := DefaultConfig()
+	c.Format = FORMAT_PROTOBUF
+	s, _ := New(broker, c)
+
+	s.publish(bus.Event{Type: bus.EDGE_ADDED, Connection: &graph.Connection{
+		Src:     "1",
+		Dst:     "2",
+		SrcNode: &graph.Node{Id: "1", Stack: "back"},
+	}})
+
+	m := broker.Messages()
+	assert.Len(t, m, 1)
+	assert.Equal(t, "back", m[0].Key)
+	var e events.TopologyEvent
+	assert.Nil(t, proto.Unmarshal(m[0].Value, &e))
+	assert.Equal(t, events.EventType_EDGE_ADDED, e.Type)
+	assert.Equal(t, "2", e.Edge.Destination)
+}
+
+func TestSink_PublishEveryType(t *testing.T) {
+	for _, format := range []string{FORMAT_JSON, FORMAT_PROTOBUF} {
+		broker := NewMemoryBroker()
+		c := DefaultConfig()
+		c.Format = format
+		s, _ := New(broker, c)
+
+		for _, typ := range bus.Types {
+			e := bus.Event{Type: typ, Node: &graph.Node{Id: "1"}, Reason: "reason"}
+			if typ != bus.NODE_ADDED && typ != bus.NODE_REMOVED && typ != bus.NODE_UPDATED {
+				e = bus.Event{Type: typ, Connection: &graph.Connection{Src: "1", Dst: "2"}, Reason: "reason"}
+			}
+			s.publish(e)
+		}
+
+		m := broker.Messages()
+		assert.Len(t, m, len(bus.Types), format)
+		if format != FORMAT_PROTOBUF {
+			continue
+		}
+		for i, typ := range bus.Types {
+			var e events.TopologyEvent
+			assert.Nil(t, proto.Unmarshal(m[i].Value, &e))
+			assert.NotEqual(t, events.EventType_UNKNOWN, e.Type, string(typ))
+		}
+	}
+}
+
+func TestSink_PublishFailure(t *testing.T) {
+	broker := NewMemoryBroker()
+	broker.Fail(errors.New("broker down"))
+	s, _ := New(broker, DefaultConfig())
+	before := testutil.ToFloat64(metrics.SinkFailures)
+
+	s.publish(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "1"}})
+
+	assert.Equal(t, uint64(1), s.Failures())
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.SinkFailures))
+	assert.Equal(t, uint64(0), s.Published())
+}
+
+func TestSink_Run(t *testing.T) {
+	b := bus.New()
+	broker := NewMemoryBroker()
+	s, _ := New(broker, DefaultConfig())
+	go s.Run(b)
+
+	for len(broker.Messages()) == 0 {
+		b.Publish(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "1"}})
+	}
+	assert.Equal(t, "unknown", broker.Messages()[0].Key)
+}
@@ -1,75 +1,170 @@
 package sse
 
 import (
+	"context"
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/cors"
+	"docker-visualizer/aggregator/health"
+	"docker-visualizer/aggregator/logging"
+	"docker-visualizer/aggregator/metrics"
+	"docker-visualizer/aggregator/tracing"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net"
 	"net/http"
 )
 
+var log = logging.For("sse")
+
+const (
+	SUBSCRIBER_BUFFER = 256
+	CLIENT_BUFFER     = 16
+)
+
+// notification is a client event with the stacks of the nodes it is about.
+type notification struct {
+	data   []byte
+	stacks []string
+	span   trace.Span
+}
+
+type client struct {
+	messages  chan []byte
+	principal *auth.Principal
+}
+
 type Broker struct {
-	notifier         chan []byte
-	incomingClients  chan chan []byte
-	outcomingClients chan chan []byte
-	clients          map[chan []byte]bool
+	notifier         chan notification
+	incomingClients  chan *client
+	outcomingClients chan *client
+	clients          map[*client]bool
+	auth             *auth.Auth
 }
 
 type IBroker interface {
 	ServeHTTP(w http.ResponseWriter, req *http.Request)
 	listen()
-	close(message chan []byte)
-	getNotifier() chan []byte
+	close(c *client)
+	getNotifier() chan notification
 }
 
-func newSSE() IBroker {
+func newSSE(a *auth.Auth) IBroker {
 	broker := &Broker{
-		notifier:         make(chan []byte, 1),
-		incomingClients:  make(chan chan []byte),
-		outcomingClients: make(chan chan []byte),
-		clients:          make(map[chan []byte]bool),
+		notifier:         make(chan notification, 1),
+		incomingClients:  make(chan *client),
+		outcomingClients: make(chan *client),
+		clients:          make(map[*client]bool),
+		auth:             a,
 	}
 	go broker.listen()
 	return broker
 }
 
-func Start(streamer *chan []byte) {
+func newNotification(e bus.Event) (notification, error) {
+	data, err := e.MarshalClientEvent()
+	if err != nil || data == nil {
+		return notification{}, err
+	}
+	m := notification{data: data}
+	for _, n := range e.Nodes() {
+		if n != nil {
+			m.stacks = append(m.stacks, n.Stack)
+		}
+	}
+	return m, nil
+}
+
+// Start serves the bus events to the UI. Clients only receive the events
+// whose nodes all belong to stacks they are allowed to see.
+func Start(events *bus.Bus, h *health.Health, a *auth.Auth, c *cors.Cors) {
 	log.Info("Starting Server sent event")
-	b := newSSE()
+	b := newSSE(a)
+	sub := events.Subscribe("sse", SUBSCRIBER_BUFFER, bus.DropOldest)
 	go func() {
-		for {
-			b.getNotifier() <- <-*streamer
+		for e := range sub.Events() {
+			m, err := newNotification(e)
+			if err != nil {
+				log.WithField("error", err).Error("Error while marshalling event client")
+			} else if m.data != nil {
+				ctx := trace.ContextWithRemoteSpanContext(context.Background(), e.Span)
+				_, m.span = tracing.Tracer().Start(ctx, "sse.Fanout")
+				b.getNotifier() <- m
+			}
 		}
 	}()
 	http.Handle("/streaming", b)
-	log.Fatal("HTTP server error: ", http.ListenAndServe(":1234", nil))
+	l, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		h.Set("sse", err)
+		log.Fatal("HTTP server error: ", err)
+	}
+	h.Set("sse", nil)
+	err = http.Serve(l, c.Handler(http.DefaultServeMux))
+	h.Set("sse", err)
+	log.Fatal("HTTP server error: ", err)
 }
 
-func (b *Broker) getNotifier() chan []byte {
+func (b *Broker) getNotifier() chan notification {
 	return b.notifier
 }
 
+func (c *client) allowed(stacks []string) bool {
+	for _, s := range stacks {
+		if !c.principal.Allowed(s) {
+			return false
+		}
+	}
+	return true
+}
+
 func (b *Broker) listen() {
 	for {
 		select {
 		case x := <-b.incomingClients:
 			b.clients[x] = true
+			metrics.SSEClients.Set(float64(len(b.clients)))
 			log.WithField("clients size", len(b.clients)).Info("New client")
 		case x := <-b.outcomingClients:
 			delete(b.clients, x)
+			metrics.SSEClients.Set(float64(len(b.clients)))
 			log.WithField("clients size", len(b.clients)).Info("Delete client")
 		case x := <-b.notifier:
-			for channel := range b.clients {
-				channel <- x
+			sent, dropped := 0, 0
+			for c := range b.clients {
+				if !c.allowed(x.stacks) {
+					continue
+				}
+				select {
+				case c.messages <- x.data:
+					sent++
+				default:
+					dropped++
+					metrics.SSEDropped.Inc()
+				}
+			}
+			if x.span != nil {
+				x.span.SetAttributes(attribute.Int("sse.sent", sent), attribute.Int("sse.dropped", dropped))
+				x.span.End()
 			}
 		}
 	}
 }
 
-func (b *Broker) close(message chan []byte) {
-	b.outcomingClients <- message
+func (b *Broker) close(c *client) {
+	b.outcomingClients <- c
 }
 
 func (b *Broker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
+	principal, err := b.auth.Authenticate(req)
+	if err != nil {
+		log.WithField("remote", req.RemoteAddr).WithField("error", err).Warn("Authentication failed")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
@@ -78,19 +173,19 @@ func (b *Broker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	messageChan := make(chan []byte)
+	c := &client{messages: make(chan []byte, CLIENT_BUFFER), principal: principal}
+	messageChan := c.messages
 
-	b.incomingClients <- messageChan
+	b.incomingClients <- c
 
-	defer b.close(messageChan)
+	defer b.close(c)
 
 	notify := w.(http.CloseNotifier).CloseNotify()
 
 	go func() {
 		<-notify
-		b.outcomingClients <- messageChan
+		b.outcomingClients <- c
 	}()
 
 	for {
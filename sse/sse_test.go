@@ -1,12 +1,55 @@
 package sse
 
 import (
+	"docker-visualizer/aggregator/auth"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestNewSse(t *testing.T) {
-	b := newSSE()
+	b := newSSE(nil)
 	assert.NotNil(t, b)
 	assert.NotNil(t, b.getNotifier())
 }
+
+func TestNewNotification(t *testing.T) {
+	n, err := newNotification(bus.Event{
+		Type: bus.CONNECTION_OBSERVED,
+		Connection: &graph.Connection{
+			SrcNode: &graph.Node{Id: "1", Stack: "a"},
+			DstNode: &graph.Node{Id: "2", Stack: "b"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, n.data)
+	assert.Equal(t, []string{"a", "b"}, n.stacks)
+
+	n, err = newNotification(bus.Event{Type: bus.EventType("UNKNOWN")})
+	assert.Nil(t, err)
+	assert.Nil(t, n.data)
+}
+
+func TestBrokerFiltersStacks(t *testing.T) {
+	b := newSSE(nil)
+	c := &client{messages: make(chan []byte, 2), principal: &auth.Principal{Stacks: []string{"a"}}}
+	b.(*Broker).incomingClients <- c
+
+	b.getNotifier() <- notification{data: []byte("b"), stacks: []string{"b"}}
+	b.getNotifier() <- notification{data: []byte("ab"), stacks: []string{"a", "b"}}
+	b.getNotifier() <- notification{data: []byte("a"), stacks: []string{"a"}}
+
+	assert.Equal(t, []byte("a"), <-c.messages)
+}
+
+func TestBrokerAuthentication(t *testing.T) {
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Stacks: []string{"a"}}}})
+	b := newSSE(a)
+	req := httptest.NewRequest(http.MethodGet, "/streaming", nil)
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
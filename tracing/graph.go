@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"docker-visualizer/aggregator/graph"
+	pb "docker-visualizer/proto/containers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// tracedGraph records a span for every graph call, as a child of the
+// request the graph is bound to with graph.WithContext.
+type tracedGraph struct {
+	graph graph.IGraph
+	ctx   context.Context
+}
+
+func TraceGraph(g graph.IGraph) graph.IGraph {
+	return &tracedGraph{graph: g, ctx: context.Background()}
+}
+
+func (g *tracedGraph) WithContext(ctx context.Context) graph.IGraph {
+	return &tracedGraph{graph: graph.WithContext(g.graph, ctx), ctx: ctx}
+}
+
+func (g *tracedGraph) start(method string) trace.Span {
+	_, span := Tracer().Start(g.ctx, "graph."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "dgraph"), attribute.String("db.operation", method)),
+	)
+	return span
+}
+
+func (g *tracedGraph) InitializedSchema() error {
+	span := g.start("InitializedSchema")
+	err := g.graph.InitializedSchema()
+	End(span, err)
+	return err
+}
+
+func (g *tracedGraph) Ping() error {
+	span := g.start("Ping")
+	err := g.graph.Ping()
+	End(span, err)
+	return err
+}
+
+func (g *tracedGraph) ExistID(id string) (bool, error) {
+	span := g.start("ExistID")
+	r, err := g.graph.ExistID(id)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) Exist(stack, ip, host string) (bool, error) {
+	span := g.start("Exist")
+	r, err := g.graph.Exist(stack, ip, host)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) FindByStack(stack string) ([]byte, error) {
+	span := g.start("FindByStack")
+	r, err := g.graph.FindByStack(stack)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) FindNodeById(id string) ([]byte, error) {
+	span := g.start("FindNodeById")
+	r, err := g.graph.FindNodeById(id)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) FindNodeByIp(ip string) ([]byte, error) {
+	span := g.start("FindNodeByIp")
+	r, err := g.graph.FindNodeByIp(ip)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) FindNode(id string) (*graph.Node, error) {
+	span := g.start("FindNode")
+	r, err := g.graph.FindNode(id)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) FindTopology(stack string) (*graph.Topology, error) {
+	span := g.start("FindTopology")
+	r, err := g.graph.FindTopology(stack)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) DeleteNode(id string) error {
+	span := g.start("DeleteNode")
+	err := g.graph.DeleteNode(id)
+	End(span, err)
+	return err
+}
+
+func (g *tracedGraph) InsertNode(info *pb.ContainerInfo, agent string) error {
+	span := g.start("InsertNode")
+	err := g.graph.InsertNode(info, agent)
+	End(span, err)
+	return err
+}
+
+func (g *tracedGraph) UpdateNode(info *pb.ContainerInfo, agent string) error {
+	span := g.start("UpdateNode")
+	err := g.graph.UpdateNode(info, agent)
+	End(span, err)
+	return err
+}
+
+func (g *tracedGraph) ExpireEdges(before time.Time) ([]graph.Connection, error) {
+	span := g.start("ExpireEdges")
+	r, err := g.graph.ExpireEdges(before)
+	End(span, err)
+	return r, err
+}
+
+func (g *tracedGraph) Connect(event *pb.ContainerEvent, agent string, check graph.EdgeCheck) (*graph.Connection, error) {
+	span := g.start("Connect")
+	r, err := g.graph.Connect(event, agent, check)
+	End(span, err)
+	return r, err
+}
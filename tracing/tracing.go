@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"docker-visualizer/aggregator/logging"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+var log = logging.For("tracing")
+
+const (
+	EXPORTER_OTLP   = "otlp"
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_FILE   = "file"
+	SERVICE_NAME    = "aggregator"
+	TRACER          = "docker-visualizer/aggregator"
+)
+
+// Config selects the span exporter. An empty Exporter disables tracing.
+// Endpoint is the OTLP/gRPC collector address and File the output of the
+// file exporter. SampleRatio applies to traces not started by an agent.
+type Config struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	File        string  `json:"file"`
+	SampleRatio float64 `json:"sample_ratio"`
+	ServiceName string  `json:"service_name"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Endpoint:    "127.0.0.1:4317",
+		SampleRatio: 1,
+		ServiceName: SERVICE_NAME,
+	}
+}
+
+// Tracer is the tracer of the aggregator. It is a no-op until Setup is called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TRACER)
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes the spans left on shutdown.
+func Setup(c Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case EXPORTER_OTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+		if c.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case EXPORTER_STDOUT:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case EXPORTER_FILE:
+		var f *os.File
+		if f, err = os.OpenFile(c.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		}
+	default:
+		err = errors.New("unknown trace exporter " + c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(c.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	log.WithField("exporter", c.Exporter).WithField("ratio", c.SampleRatio).Info("Tracing enabled")
+	return provider.Shutdown, nil
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
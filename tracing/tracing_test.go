@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+type graphStub struct {
+	graph.IGraph
+}
+
+func (g *graphStub) FindNode(id string) (*graph.Node, error) {
+	return &graph.Node{Id: id}, nil
+}
+
+func record() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+
+	_, err = Setup(Config{Exporter: "zipkin"})
+	assert.NotNil(t, err)
+}
+
+func TestRpcContinuesAgentTrace(t *testing.T) {
+	recorder := record()
+	g := TraceGraph(&graphStub{})
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return graph.WithContext(g, ctx).FindNode("123")
+	}
+	_, err := UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/containers.ContainerService/RemoveNode"}, handler)
+	assert.Nil(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	call, rpc := spans[0], spans[1]
+	assert.Equal(t, "graph.FindNode", call.Name())
+	assert.Equal(t, "/containers.ContainerService/RemoveNode", rpc.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rpc.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", rpc.Parent().SpanID().String())
+	assert.Equal(t, rpc.SpanContext().SpanID(), call.Parent().SpanID())
+}
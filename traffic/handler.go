@@ -0,0 +1,56 @@
+package traffic
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+type Handler struct {
+	store *Store
+}
+
+func NewHandler(s *Store) *Handler {
+	return &Handler{store: s}
+}
+
+func (h *Handler) Register(router *httprouter.Router, a *auth.Auth) {
+	router.GET("/nodes/:id/traffic", a.Wrap(h.node))
+	router.GET("/edges/:src/:dst/traffic", a.Wrap(h.edge))
+}
+
+func (h *Handler) node(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h.serve(w, r, NodeKey(params.ByName("id")))
+}
+
+func (h *Handler) edge(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h.serve(w, r, EdgeKey(params.ByName("src"), params.ByName("dst")))
+}
+
+// serve answers a series, as long as the caller may read every stack it
+// is about.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, key string) {
+	s, err := h.store.Series(key, r.URL.Query().Get("resolution"), time.Now())
+	switch err {
+	case nil:
+	case ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := auth.FromContext(r.Context())
+	for _, stack := range s.Stacks {
+		if !p.Allowed(stack) {
+			http.Error(w, "access to stack "+stack+" denied", http.StatusForbidden)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,36 @@
+package traffic
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	s := New(testConfig())
+	s.Record(connection("a", "b", 100), time.Now())
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{{Token: "secret", Name: "ui", Stacks: []string{"web"}}}})
+	router := httprouter.New()
+	NewHandler(s).Register(router, a)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/nodes/a/traffic?resolution=1m")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"resolution":"1m"`)
+
+	assert.Equal(t, 403, get("/nodes/b/traffic").Code)
+	assert.Equal(t, 403, get("/edges/a/b/traffic").Code)
+	assert.Equal(t, 404, get("/nodes/z/traffic").Code)
+	assert.Equal(t, 400, get("/nodes/a/traffic?resolution=1h").Code)
+}
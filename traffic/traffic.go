@@ -0,0 +1,243 @@
+package traffic
+
+import (
+	"container/list"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var log = logging.For("traffic")
+
+var (
+	ErrUnknownResolution = errors.New("unknown traffic resolution")
+	ErrNotFound          = errors.New("no traffic recorded")
+)
+
+// Resolution is a ring of Points buckets Step milliseconds wide.
+type Resolution struct {
+	Step   int `json:"step_ms"`
+	Points int `json:"points"`
+}
+
+// Config sizes the store: every series holds one ring per resolution, and
+// the least recently updated series are evicted beyond MaxSeries.
+type Config struct {
+	Enabled     bool         `json:"enabled"`
+	Resolutions []Resolution `json:"resolutions"`
+	MaxSeries   int          `json:"max_series"`
+	Buffer      int          `json:"buffer"`
+}
+
+type Point struct {
+	Time             time.Time `json:"time"`
+	BytesPerSecond   float64   `json:"bytes_per_second"`
+	PacketsPerSecond float64   `json:"packets_per_second"`
+}
+
+type Series struct {
+	Resolution string  `json:"resolution"`
+	Step       int     `json:"step_ms"`
+	Points     []Point `json:"points"`
+	// Stacks are the stacks of the nodes the series is about.
+	Stacks []string `json:"-"`
+}
+
+// ring keeps the totals of the last buckets of a resolution. A bucket is
+// reset when the time it covers has passed by a full turn of the ring.
+type ring struct {
+	step    time.Duration
+	stamps  []int64
+	bytes   []uint64
+	packets []uint64
+}
+
+type series struct {
+	key    string
+	stacks []string
+	rings  []*ring
+	elem   *list.Element
+}
+
+type Store struct {
+	config Config
+	mu     sync.Mutex
+	series map[string]*series
+	lru    *list.List
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled: true,
+		Resolutions: []Resolution{
+			{Step: 10000, Points: 90},
+			{Step: 60000, Points: 180},
+			{Step: 3600000, Points: 168},
+		},
+		MaxSeries: 5000,
+		Buffer:    4096,
+	}
+}
+
+// New ignores the resolutions without a step or without points.
+func New(c Config) *Store {
+	resolutions := make([]Resolution, 0, len(c.Resolutions))
+	for _, r := range c.Resolutions {
+		if r.Step <= 0 || r.Points <= 0 {
+			log.WithField("step", r.Step).WithField("points", r.Points).Warn("Ignoring invalid traffic resolution")
+			continue
+		}
+		resolutions = append(resolutions, r)
+	}
+	c.Resolutions = resolutions
+	return &Store{config: c, series: make(map[string]*series), lru: list.New()}
+}
+
+func newRing(r Resolution) *ring {
+	return &ring{
+		step:    time.Duration(r.Step) * time.Millisecond,
+		stamps:  make([]int64, r.Points),
+		bytes:   make([]uint64, r.Points),
+		packets: make([]uint64, r.Points),
+	}
+}
+
+func (r *ring) add(at time.Time, bytes uint64) {
+	bucket := at.UnixNano() / int64(r.step)
+	i := bucket % int64(len(r.stamps))
+	if r.stamps[i] != bucket {
+		r.stamps[i] = bucket
+		r.bytes[i] = 0
+		r.packets[i] = 0
+	}
+	r.bytes[i] += bytes
+	r.packets[i]++
+}
+
+// points returns the buckets of the ring up to now, oldest first.
+func (r *ring) points(now time.Time) []Point {
+	size := int64(len(r.stamps))
+	last := now.UnixNano() / int64(r.step)
+	seconds := r.step.Seconds()
+	points := make([]Point, 0, size)
+	for bucket := last - size + 1; bucket <= last; bucket++ {
+		p := Point{Time: time.Unix(0, bucket*int64(r.step)).UTC()}
+		if i := bucket % size; bucket >= 0 && r.stamps[i] == bucket {
+			p.BytesPerSecond = float64(r.bytes[i]) / seconds
+			p.PacketsPerSecond = float64(r.packets[i]) / seconds
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func NodeKey(id string) string {
+	return "node/" + id
+}
+
+func EdgeKey(src, dst string) string {
+	return "edge/" + src + "/" + dst
+}
+
+// Run records the connections published on the bus until the subscription ends.
+func (s *Store) Run(events *bus.Bus) {
+	sub := events.Subscribe("traffic", s.config.Buffer, bus.DropOldest)
+	defer sub.Close()
+	for e := range sub.Events() {
+		if e.Type == bus.CONNECTION_OBSERVED && e.Connection != nil {
+			s.Record(e.Connection, e.Time)
+		}
+	}
+}
+
+func stack(n *graph.Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.Stack
+}
+
+// Record adds an observed packet to the series of its edge and of both its
+// endpoints.
+func (s *Store) Record(c *graph.Connection, at time.Time) {
+	src, dst := stack(c.SrcNode), stack(c.DstNode)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(EdgeKey(c.Src, c.Dst), []string{src, dst}, at, uint64(c.Size))
+	s.add(NodeKey(c.Src), []string{src}, at, uint64(c.Size))
+	if c.Dst != c.Src {
+		s.add(NodeKey(c.Dst), []string{dst}, at, uint64(c.Size))
+	}
+}
+
+func (s *Store) add(key string, stacks []string, at time.Time, bytes uint64) {
+	ts, ok := s.series[key]
+	if !ok {
+		ts = &series{key: key, stacks: stacks}
+		for _, r := range s.config.Resolutions {
+			ts.rings = append(ts.rings, newRing(r))
+		}
+		ts.elem = s.lru.PushFront(ts)
+		s.series[key] = ts
+		if s.config.MaxSeries > 0 && len(s.series) > s.config.MaxSeries {
+			oldest := s.lru.Remove(s.lru.Back()).(*series)
+			delete(s.series, oldest.key)
+			log.WithField("series", oldest.key).Debug("Evicting traffic series")
+		}
+	} else {
+		s.lru.MoveToFront(ts.elem)
+	}
+	for _, r := range ts.rings {
+		r.add(at, bytes)
+	}
+}
+
+// formatStep writes a step the way it is queried: 10s, 1m or 1h.
+func formatStep(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
+
+// Series returns the points of a series up to now at the given resolution,
+// a duration such as "10s" or "1m", the finest one when empty. A series
+// never recorded, or evicted since, is not found.
+func (s *Store) Series(key, resolution string, now time.Time) (*Series, error) {
+	index := 0
+	if resolution != "" {
+		step, err := time.ParseDuration(resolution)
+		if err != nil {
+			return nil, ErrUnknownResolution
+		}
+		index = -1
+		for i, r := range s.config.Resolutions {
+			if time.Duration(r.Step)*time.Millisecond == step {
+				index = i
+			}
+		}
+	}
+	if index < 0 || index >= len(s.config.Resolutions) {
+		return nil, ErrUnknownResolution
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts, ok := s.series[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	r := ts.rings[index]
+	return &Series{
+		Resolution: formatStep(r.step),
+		Step:       s.config.Resolutions[index].Step,
+		Points:     r.points(now),
+		Stacks:     ts.stacks,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package traffic
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Enabled:     true,
+		Resolutions: []Resolution{{Step: 10000, Points: 6}, {Step: 60000, Points: 3}, {Step: 0, Points: 4}},
+		MaxSeries:   4,
+		Buffer:      16,
+	}
+}
+
+func connection(src, dst string, size uint32) *graph.Connection {
+	return &graph.Connection{
+		Src:     src,
+		Dst:     dst,
+		Size:    size,
+		SrcNode: &graph.Node{Id: src, Stack: "web"},
+		DstNode: &graph.Node{Id: dst, Stack: "data"},
+	}
+}
+
+func TestRecord(t *testing.T) {
+	c := testConfig()
+	c.MaxSeries = 0
+	s := New(c)
+	start := time.Unix(1000000, 0)
+	s.Record(connection("a", "b", 100), start)
+	s.Record(connection("a", "b", 300), start.Add(time.Second))
+	s.Record(connection("a", "b", 50), start.Add(20*time.Second))
+	s.Record(connection("c", "a", 1000), start.Add(20*time.Second))
+
+	series, err := s.Series(EdgeKey("a", "b"), "", start.Add(25*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, "10s", series.Resolution)
+	assert.Equal(t, []string{"web", "data"}, series.Stacks)
+	assert.Len(t, series.Points, 6)
+	assert.Equal(t, start.Add(20*time.Second).UTC(), series.Points[5].Time)
+	assert.Equal(t, 5.0, series.Points[5].BytesPerSecond)
+	assert.Equal(t, 0.0, series.Points[4].BytesPerSecond)
+	assert.Equal(t, 40.0, series.Points[3].BytesPerSecond)
+	assert.Equal(t, 0.2, series.Points[3].PacketsPerSecond)
+
+	series, err = s.Series(NodeKey("a"), "1m", start.Add(25*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, "1m", series.Resolution)
+	assert.Len(t, series.Points, 3)
+	assert.InDelta(t, 1050.0/60, series.Points[2].BytesPerSecond, 0.001)
+	assert.InDelta(t, 400.0/60, series.Points[1].BytesPerSecond, 0.001)
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	s := New(testConfig())
+	start := time.Unix(1000000, 0)
+	s.Record(connection("a", "b", 100), start)
+	s.Record(connection("a", "b", 10), start.Add(60*time.Second))
+
+	series, _ := s.Series(EdgeKey("a", "b"), "10s", start.Add(60*time.Second))
+	total := 0.0
+	for _, p := range series.Points {
+		total += p.BytesPerSecond
+	}
+	assert.Equal(t, 1.0, total)
+}
+
+func TestSeriesErrors(t *testing.T) {
+	s := New(testConfig())
+	s.Record(connection("a", "b", 100), time.Now())
+
+	_, err := s.Series(NodeKey("z"), "", time.Now())
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Series(NodeKey("a"), "1h", time.Now())
+	assert.Equal(t, ErrUnknownResolution, err)
+	_, err = s.Series(NodeKey("a"), "often", time.Now())
+	assert.Equal(t, ErrUnknownResolution, err)
+}
+
+func TestEviction(t *testing.T) {
+	s := New(testConfig())
+	now := time.Now()
+	s.Record(connection("a", "b", 1), now)
+	s.Record(connection("c", "d", 1), now)
+
+	_, err := s.Series(EdgeKey("a", "b"), "", now)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Series(NodeKey("b"), "", now)
+	assert.Nil(t, err)
+	assert.Len(t, s.series, 4)
+}
+
+func TestRun(t *testing.T) {
+	s := New(testConfig())
+	b := bus.New()
+	go s.Run(b)
+
+	assert.Eventually(t, func() bool {
+		b.Publish(bus.Event{Type: bus.CONNECTION_OBSERVED, Connection: connection("a", "b", 10)})
+		_, err := s.Series(EdgeKey("a", "b"), "", time.Now())
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
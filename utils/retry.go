@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"time"
+)
+
+type RetryConfig struct {
+	Initial  int `json:"initial_ms"`
+	Max      int `json:"max_ms"`
+	Attempts int `json:"attempts"`
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Initial: 500,
+		Max:     30000,
+	}
+}
+
+// Retry calls fn until it succeeds, doubling the wait between attempts up to
+// the configured maximum. Zero attempts retries forever; otherwise the last
+// error is returned once every attempt failed.
+func Retry(c RetryConfig, name string, fn func() error) error {
+	backoff := time.Duration(c.Initial) * time.Millisecond
+	max := time.Duration(c.Max) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if c.Attempts > 0 && attempt >= c.Attempts {
+			return err
+		}
+		log.
+			WithField("operation", name).
+			WithField("attempt", attempt).
+			WithField("retry in", backoff).
+			WithField("Error", err.Error()).Warn("Operation failed, retrying")
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > max {
+			backoff = max
+		}
+	}
+}
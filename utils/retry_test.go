@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry(RetryConfig{Initial: 1, Max: 2}, "test", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryAttempts(t *testing.T) {
+	calls := 0
+	err := Retry(RetryConfig{Initial: 1, Max: 2, Attempts: 2}, "test", func() error {
+		calls++
+		return errors.New("unavailable")
+	})
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, 2, calls)
+}
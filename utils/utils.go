@@ -1,22 +1,52 @@
 package utils
 
 import (
-	log "github.com/sirupsen/logrus"
+	"docker-visualizer/aggregator/certs"
+	"docker-visualizer/aggregator/logging"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"io/ioutil"
 	"net"
 )
 
+var log = logging.For("utils")
+
 const (
 	DGRAPH_ENDPOINT = "127.0.0.1:9080"
 )
 
-func SetupGrpcConnection() *grpc.ClientConn {
-	c, e := grpc.Dial(DGRAPH_ENDPOINT, grpc.WithInsecure())
+type BackendConfig struct {
+	Endpoint string       `json:"endpoint"`
+	Retry    RetryConfig  `json:"retry"`
+	TLS      certs.Config `json:"tls"`
+}
+
+func DefaultBackendConfig() BackendConfig {
+	return BackendConfig{
+		Endpoint: DGRAPH_ENDPOINT,
+		Retry:    DefaultRetryConfig(),
+		TLS:      certs.DefaultConfig(),
+	}
+}
+
+// SetupGrpcConnection does not wait for the database: the dial only fails on
+// invalid options and the connection reconnects on its own. Reaching the
+// database is retried by graph.MaintainSchema.
+func SetupGrpcConnection(c BackendConfig) *grpc.ClientConn {
+	creds := grpc.WithInsecure()
+	if c.TLS.Enabled() {
+		store, e := certs.NewStore(c.TLS)
+		if e != nil {
+			log.WithField("Error", e.Error()).Fatal("Cannot load database TLS certificates")
+		}
+		go store.Watch()
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(store.ClientConfig()))
+	}
+	conn, e := grpc.Dial(c.Endpoint, creds)
 	if e != nil {
 		log.WithField("Error", e.Error()).Fatal("Cannot open grpc connection to the database")
 	}
-	return c
+	return conn
 }
 
 func SetupDatabaseDir() string {
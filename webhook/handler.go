@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// MAX_TARGET_SIZE bounds the targets registered through the API.
+const MAX_TARGET_SIZE = 64 << 10
+
+type Handler struct {
+	dispatcher *Dispatcher
+}
+
+func NewHandler(d *Dispatcher) *Handler {
+	return &Handler{dispatcher: d}
+}
+
+func (h *Handler) Register(router *httprouter.Router, a *auth.Auth) {
+	router.GET("/webhooks", a.Wrap(h.list))
+	router.POST("/webhooks", a.Wrap(h.create))
+	router.DELETE("/webhooks/:id", a.Wrap(h.remove))
+	router.GET("/webhooks/:id/stats", a.Wrap(h.stats))
+}
+
+// owns tells whether the principal may manage the target: its own targets,
+// or any target for a principal granted every stack.
+func owns(p *auth.Principal, t Target) bool {
+	return p.Allowed(auth.ALL_STACKS) || (p != nil && t.Owner == p.Name)
+}
+
+// restrict limits the stacks of a filter to the ones the principal may see,
+// every stack of the principal when the filter names none.
+func restrict(p *auth.Principal, stacks []string) ([]string, error) {
+	if p.Allowed(auth.ALL_STACKS) {
+		return stacks, nil
+	}
+	if len(stacks) == 0 {
+		if len(p.Stacks) == 0 {
+			return nil, fmt.Errorf("principal %s may not see any stack", p.Name)
+		}
+		return p.Stacks, nil
+	}
+	for _, s := range stacks {
+		if !p.Allowed(s) {
+			return nil, fmt.Errorf("access to stack %s denied", s)
+		}
+	}
+	return stacks, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	p := auth.FromContext(r.Context())
+	targets := make([]Target, 0)
+	for _, t := range h.dispatcher.Targets() {
+		if owns(p, t) {
+			targets = append(targets, t)
+		}
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// owned answers 404 for the targets the caller does not own, so that their
+// ids are not disclosed, and reports whether the caller owns the target.
+func (h *Handler) owned(w http.ResponseWriter, r *http.Request, id string) bool {
+	t, ok := h.dispatcher.Target(id)
+	if !ok || !owns(auth.FromContext(r.Context()), t) {
+		http.Error(w, "webhook target not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var t Target
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_TARGET_SIZE)).Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := auth.FromContext(r.Context())
+	var err error
+	if t.Filter.Stacks, err = restrict(p, t.Filter.Stacks); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if t.Filter.SourceStacks, err = restrict(p, t.Filter.SourceStacks); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	t.Owner = p.Name
+	if err := h.dispatcher.Add(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t.Secret = ""
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !h.owned(w, r, params.ByName("id")) {
+		return
+	}
+	if !h.dispatcher.Remove(params.ByName("id")) {
+		http.Error(w, "webhook target not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !h.owned(w, r, params.ByName("id")) {
+		return
+	}
+	s, ok := h.dispatcher.Stats(params.ByName("id"))
+	if !ok {
+		http.Error(w, "webhook target not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"docker-visualizer/aggregator/auth"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	router := httprouter.New()
+	NewHandler(NewDispatcher(testConfig())).Register(router, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"id":"hook","url":"http://localhost","secret":"s"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+	assert.NotContains(t, w.Body.String(), `"secret"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/webhooks", strings.NewReader(`{"id":"big","url":"http://localhost","secret":"`+strings.Repeat("s", MAX_TARGET_SIZE)+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/webhooks/hook/stats", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"delivered":0`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/webhooks/hook", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 204, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/webhooks/hook/stats", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestHandlerAuthorization(t *testing.T) {
+	a, _ := auth.New(auth.Config{Tokens: []auth.Token{
+		{Token: "web", Name: "web", Stacks: []string{"web"}},
+		{Token: "data", Name: "data", Stacks: []string{"data"}},
+	}})
+	d := NewDispatcher(testConfig())
+	router := httprouter.New()
+	NewHandler(d).Register(router, a)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 401, do("POST", "/webhooks", "", `{"id":"hook","url":"http://localhost"}`).Code)
+	assert.Equal(t, 403, do("POST", "/webhooks", "web", `{"id":"hook","url":"http://localhost","filter":{"stacks":["data"]}}`).Code)
+	assert.Equal(t, 201, do("POST", "/webhooks", "web", `{"id":"hook","url":"http://localhost"}`).Code)
+
+	target, _ := d.Target("hook")
+	assert.Equal(t, "web", target.Owner)
+	assert.Equal(t, []string{"web"}, target.Filter.Stacks)
+	assert.Equal(t, []string{"web"}, target.Filter.SourceStacks)
+
+	assert.Equal(t, "[]\n", do("GET", "/webhooks", "data", "").Body.String())
+	assert.Equal(t, 404, do("GET", "/webhooks/hook/stats", "data", "").Code)
+	assert.Equal(t, 404, do("DELETE", "/webhooks/hook", "data", "").Code)
+	assert.Contains(t, do("GET", "/webhooks", "web", "").Body.String(), `"id":"hook"`)
+	assert.Equal(t, 204, do("DELETE", "/webhooks/hook", "web", "").Code)
+}
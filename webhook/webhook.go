@@ -0,0 +1,463 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"docker-visualizer/aggregator/logging"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var log = logging.For("webhook")
+
+const (
+	SIGNATURE_HEADER = "X-Aggregator-Signature"
+	EVENT_HEADER     = "X-Aggregator-Event"
+	DELIVERY_HEADER  = "X-Aggregator-Delivery"
+)
+
+// Config of the dispatcher. Targets are never reached on loopback, link
+// local, private or unspecified addresses unless AllowedNetworks, a list of
+// CIDRs, includes them.
+type Config struct {
+	Targets         []Target `json:"targets"`
+	DeadLetter      string   `json:"dead_letter"`
+	MaxAttempts     int      `json:"max_attempts"`
+	InitialBackoff  int      `json:"initial_backoff_ms"`
+	MaxBackoff      int      `json:"max_backoff_ms"`
+	Timeout         int      `json:"timeout_ms"`
+	QueueSize       int      `json:"queue_size"`
+	AllowedNetworks []string `json:"allowed_networks"`
+}
+
+// Filter selects the events sent to a target. Empty fields match everything;
+// EDGE_ADDED selects new edges while CONNECTION_OBSERVED fires on every packet.
+// Stacks and Hosts apply to the node of node events and to the destination
+// of edges; SourceStacks and SourceHosts apply to the source of edges.
+type Filter struct {
+	Events       []bus.EventType `json:"events,omitempty"`
+	Stacks       []string        `json:"stacks,omitempty"`
+	Hosts        []string        `json:"hosts,omitempty"`
+	SourceStacks []string        `json:"source_stacks,omitempty"`
+	SourceHosts  []string        `json:"source_hosts,omitempty"`
+}
+
+// Target is an endpoint receiving events. Owner is the principal that
+// registered it through the API, empty for configured targets.
+type Target struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	Filter Filter `json:"filter"`
+	Owner  string `json:"owner,omitempty"`
+}
+
+type Stats struct {
+	Delivered    uint64    `json:"delivered"`
+	Failed       uint64    `json:"failed"`
+	Retried      uint64    `json:"retried"`
+	Dropped      uint64    `json:"dropped"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastDelivery time.Time `json:"last_delivery,omitempty"`
+}
+
+type Payload struct {
+	Id          string        `json:"id"`
+	Event       bus.EventType `json:"event"`
+	Time        time.Time     `json:"time"`
+	Node        *graph.Node   `json:"node,omitempty"`
+	Source      *graph.Node   `json:"source,omitempty"`
+	Destination *graph.Node   `json:"destination,omitempty"`
+	Size        uint32        `json:"size,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+}
+
+type deadLetter struct {
+	Target   string    `json:"target"`
+	Url      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+	Payload  Payload   `json:"payload"`
+}
+
+type target struct {
+	Target
+	queue chan Payload
+	stop  chan struct{}
+	mu    sync.Mutex
+	stats Stats
+}
+
+type Dispatcher struct {
+	config  Config
+	client  *http.Client
+	allowed []*net.IPNet
+	mu      sync.RWMutex
+	targets map[string]*target
+	dlMu    sync.Mutex
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: 500,
+		MaxBackoff:     30000,
+		Timeout:        5000,
+		QueueSize:      1024,
+	}
+}
+
+func NewDispatcher(config Config) *Dispatcher {
+	d := &Dispatcher{
+		config:  config,
+		targets: make(map[string]*target),
+	}
+	for _, cidr := range config.AllowedNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithField("network", cidr).WithField("error", err).Error("Cannot parse webhook allowed network")
+			continue
+		}
+		d.allowed = append(d.allowed, n)
+	}
+	// Addresses are checked when dialing, after resolution and on every
+	// redirect, so that a name cannot be pointed at an internal host later.
+	dialer := &net.Dialer{Timeout: time.Duration(config.Timeout) * time.Millisecond, Control: d.control}
+	d.client = &http.Client{
+		Timeout:   time.Duration(config.Timeout) * time.Millisecond,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+	for _, t := range config.Targets {
+		if err := d.Add(t); err != nil {
+			log.WithField("target", t.Id).WithField("error", err).Error("Cannot register webhook target")
+		}
+	}
+	return d
+}
+
+// Run forwards bus events to the matching targets until the subscription ends.
+func (d *Dispatcher) Run(events *bus.Bus) {
+	sub := events.Subscribe("webhook", d.config.QueueSize, bus.DropOldest)
+	defer sub.Close()
+	for e := range sub.Events() {
+		d.dispatch(e)
+	}
+}
+
+func (d *Dispatcher) dispatch(e bus.Event) {
+	p := newPayload(e)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.targets {
+		if !t.Filter.match(e) {
+			continue
+		}
+		select {
+		case t.queue <- p:
+		default:
+			t.mu.Lock()
+			t.stats.Dropped++
+			t.mu.Unlock()
+			log.WithField("target", t.Id).Warn("Webhook queue full, dropping event")
+		}
+	}
+}
+
+// allowedIP tells whether targets may be reached on the address.
+func (d *Dispatcher) allowedIP(ip net.IP) bool {
+	for _, n := range d.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified())
+}
+
+func (d *Dispatcher) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !d.allowedIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// checkUrl requires an http or https url with a host, refusing the hosts
+// given as a forbidden address upfront.
+func (d *Dispatcher) checkUrl(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("webhook url must be http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("webhook url needs a host")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !d.allowedIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", ip)
+	}
+	return nil
+}
+
+func (d *Dispatcher) Add(t Target) error {
+	if t.Id == "" || t.Url == "" {
+		return errors.New("webhook target needs an id and an url")
+	}
+	if err := d.checkUrl(t.Url); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.targets[t.Id]; ok {
+		return fmt.Errorf("webhook target %s already exists", t.Id)
+	}
+	w := &target{
+		Target: t,
+		queue:  make(chan Payload, d.config.QueueSize),
+		stop:   make(chan struct{}),
+	}
+	d.targets[t.Id] = w
+	go d.deliver(w)
+	log.WithField("target", t.Id).WithField("url", t.Url).Info("New webhook target")
+	return nil
+}
+
+func (d *Dispatcher) Remove(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.targets[id]
+	if ok {
+		close(t.stop)
+		delete(d.targets, id)
+		log.WithField("target", id).Info("Delete webhook target")
+	}
+	return ok
+}
+
+// Targets lists the registered targets with their secrets removed.
+func (d *Dispatcher) Targets() []Target {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	targets := make([]Target, 0, len(d.targets))
+	for _, t := range d.targets {
+		r := t.Target
+		r.Secret = ""
+		targets = append(targets, r)
+	}
+	return targets
+}
+
+// Target returns a registered target with its secret removed.
+func (d *Dispatcher) Target(id string) (Target, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.targets[id]
+	if !ok {
+		return Target{}, false
+	}
+	r := t.Target
+	r.Secret = ""
+	return r, true
+}
+
+func (d *Dispatcher) Stats(id string) (Stats, bool) {
+	d.mu.RLock()
+	t, ok := d.targets[id]
+	d.mu.RUnlock()
+	if !ok {
+		return Stats{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats, true
+}
+
+func (d *Dispatcher) deliver(t *target) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case p := <-t.queue:
+			d.send(t, p)
+		}
+	}
+}
+
+// send posts the payload, retrying with exponential backoff on network errors,
+// 429 and 5xx responses. Exhausted or rejected deliveries go to the dead letter log.
+func (d *Dispatcher) send(t *target, p Payload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.WithField("error", err).Error("Error while marshalling webhook payload")
+		return
+	}
+	backoff := time.Duration(d.config.InitialBackoff) * time.Millisecond
+	attempts := 0
+	for {
+		attempts++
+		retry, err := d.post(t, p, body)
+		if err == nil {
+			t.mu.Lock()
+			t.stats.Delivered++
+			t.stats.LastDelivery = time.Now()
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Lock()
+		t.stats.LastError = err.Error()
+		t.mu.Unlock()
+		if !retry || attempts >= d.config.MaxAttempts {
+			t.mu.Lock()
+			t.stats.Failed++
+			t.mu.Unlock()
+			d.deadLetter(t, p, attempts, err)
+			return
+		}
+		t.mu.Lock()
+		t.stats.Retried++
+		t.mu.Unlock()
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if max := time.Duration(d.config.MaxBackoff) * time.Millisecond; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+func (d *Dispatcher) post(t *target, p Payload, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, t.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, string(p.Event))
+	req.Header.Set(DELIVERY_HEADER, p.Id)
+	if t.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(t.Secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook target answered %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+func (d *Dispatcher) deadLetter(t *target, p Payload, attempts int, err error) {
+	log.
+		WithField("target", t.Id).
+		WithField("delivery", p.Id).
+		WithField("attempts", attempts).
+		WithField("error", err).Error("Webhook delivery failed")
+	if d.config.DeadLetter == "" {
+		return
+	}
+	b, e := json.Marshal(deadLetter{
+		Target:   t.Id,
+		Url:      t.Url,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Time:     time.Now(),
+		Payload:  p,
+	})
+	if e != nil {
+		log.WithField("error", e).Error("Error while marshalling dead letter")
+		return
+	}
+	d.dlMu.Lock()
+	defer d.dlMu.Unlock()
+	f, e := os.OpenFile(d.config.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		log.WithField("error", e).Error("Cannot open webhook dead letter log")
+		return
+	}
+	defer f.Close()
+	if _, e := f.Write(append(b, '\n')); e != nil {
+		log.WithField("error", e).Error("Cannot write webhook dead letter log")
+	}
+}
+
+// Sign returns the signature header value of a payload: the hex encoded
+// HMAC-SHA256 of the body, keyed with the target secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newPayload(e bus.Event) Payload {
+	p := Payload{Id: deliveryId(), Event: e.Type, Time: e.Time, Node: e.Node, Reason: e.Reason}
+	if c := e.Connection; c != nil {
+		p.Source = c.SrcNode
+		p.Destination = c.DstNode
+		p.Size = c.Size
+	}
+	return p
+}
+
+func deliveryId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNode(n *graph.Node, stacks, hosts []string) bool {
+	if len(stacks) == 0 && len(hosts) == 0 {
+		return true
+	}
+	if n == nil {
+		return false
+	}
+	return (len(stacks) == 0 || contains(stacks, n.Stack)) && (len(hosts) == 0 || contains(hosts, n.Host))
+}
+
+func (f Filter) match(e bus.Event) bool {
+	if len(f.Events) > 0 {
+		found := false
+		for _, t := range f.Events {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if c := e.Connection; c != nil {
+		return matchNode(c.DstNode, f.Stacks, f.Hosts) && matchNode(c.SrcNode, f.SourceStacks, f.SourceHosts)
+	}
+	return matchNode(e.Node, f.Stacks, f.Hosts)
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"docker-visualizer/aggregator/bus"
+	"docker-visualizer/aggregator/graph"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	c := DefaultConfig()
+	c.InitialBackoff = 1
+	c.MaxBackoff = 2
+	c.MaxAttempts = 3
+	c.AllowedNetworks = []string{"127.0.0.0/8"}
+	return c
+}
+
+func waitStats(t *testing.T, d *Dispatcher, id string, done func(Stats) bool) Stats {
+	for i := 0; i < 200; i++ {
+		s, _ := d.Stats(id)
+		if done(s) {
+			return s
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("webhook delivery did not complete")
+	return Stats{}
+}
+
+func TestFilter_Match(t *testing.T) {
+	payments := &graph.Node{Id: "1", Stack: "payments", Host: "h1"}
+	front := &graph.Node{Id: "2", Stack: "front", Host: "h2"}
+	edge := bus.Event{Type: bus.EDGE_ADDED, Connection: &graph.Connection{SrcNode: front, DstNode: payments}}
+
+	into := Filter{Events: []bus.EventType{bus.EDGE_ADDED}, Stacks: []string{"payments"}}
+	assert.True(t, into.match(edge))
+	assert.False(t, into.match(bus.Event{Type: bus.CONNECTION_OBSERVED, Connection: edge.Connection}))
+	assert.False(t, into.match(bus.Event{Type: bus.NODE_ADDED, Node: payments}))
+
+	from := Filter{SourceStacks: []string{"payments"}}
+	assert.False(t, from.match(edge))
+
+	removed := Filter{Events: []bus.EventType{bus.NODE_REMOVED}, Hosts: []string{"h2"}}
+	assert.True(t, removed.match(bus.Event{Type: bus.NODE_REMOVED, Node: front}))
+	assert.False(t, removed.match(bus.Event{Type: bus.NODE_REMOVED, Node: payments}))
+
+	assert.True(t, Filter{}.match(edge))
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, Sign("secret", body), r.Header.Get(SIGNATURE_HEADER))
+		assert.Equal(t, string(bus.NODE_ADDED), r.Header.Get(EVENT_HEADER))
+		var p Payload
+		json.Unmarshal(body, &p)
+		received <- p
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(testConfig())
+	assert.Nil(t, d.Add(Target{Id: "hook", Url: server.URL, Secret: "secret"}))
+	d.dispatch(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "123"}})
+
+	p := <-received
+	assert.Equal(t, "123", p.Node.Id)
+	assert.NotEmpty(t, p.Id)
+	s := waitStats(t, d, "hook", func(s Stats) bool { return s.Delivered == 1 })
+	assert.Equal(t, uint64(0), s.Failed)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(testConfig())
+	d.Add(Target{Id: "hook", Url: server.URL})
+	d.dispatch(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "123"}})
+
+	s := waitStats(t, d, "hook", func(s Stats) bool { return s.Delivered == 1 })
+	assert.Equal(t, uint64(2), s.Retried)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "webhook_")
+	defer os.RemoveAll(dir)
+	c := testConfig()
+	c.DeadLetter = filepath.Join(dir, "dead.log")
+
+	d := NewDispatcher(c)
+	d.Add(Target{Id: "hook", Url: server.URL})
+	d.dispatch(bus.Event{Type: bus.NODE_REMOVED, Node: &graph.Node{Id: "123"}})
+
+	s := waitStats(t, d, "hook", func(s Stats) bool { return s.Failed == 1 })
+	assert.Equal(t, uint64(0), s.Retried)
+
+	var b []byte
+	for i := 0; i < 200 && len(b) == 0; i++ {
+		b, _ = ioutil.ReadFile(c.DeadLetter)
+		time.Sleep(time.Millisecond)
+	}
+	var dl deadLetter
+	assert.Nil(t, json.Unmarshal(b, &dl))
+	assert.Equal(t, "hook", dl.Target)
+	assert.Equal(t, 1, dl.Attempts)
+	assert.Equal(t, "123", dl.Payload.Node.Id)
+}
+
+func TestDispatcher_Addresses(t *testing.T) {
+	d := NewDispatcher(DefaultConfig())
+	assert.NotNil(t, d.Add(Target{Id: "ftp", Url: "ftp://example.com"}))
+	assert.NotNil(t, d.Add(Target{Id: "nohost", Url: "http:///hook"}))
+	assert.NotNil(t, d.Add(Target{Id: "metadata", Url: "http://169.254.169.254/latest"}))
+	assert.NotNil(t, d.Add(Target{Id: "private", Url: "http://10.0.0.1/hook"}))
+	assert.NotNil(t, d.Add(Target{Id: "loopback", Url: "http://[::1]/hook"}))
+	assert.Nil(t, d.Add(Target{Id: "public", Url: "https://203.0.113.1/hook"}))
+
+	called := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&called, 1)
+	}))
+	defer server.Close()
+	// A name resolving to a forbidden address is refused when dialing.
+	c := DefaultConfig()
+	c.MaxAttempts = 1
+	d = NewDispatcher(c)
+	assert.Nil(t, d.Add(Target{Id: "hook", Url: strings.Replace(server.URL, "127.0.0.1", "localhost", 1)}))
+	d.dispatch(bus.Event{Type: bus.NODE_ADDED, Node: &graph.Node{Id: "123"}})
+	s := waitStats(t, d, "hook", func(s Stats) bool { return s.Failed == 1 })
+	assert.Contains(t, s.LastError, "not allowed")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&called))
+}
+
+func TestDispatcher_AddRemove(t *testing.T) {
+	d := NewDispatcher(testConfig())
+	assert.NotNil(t, d.Add(Target{Id: "hook"}))
+	assert.Nil(t, d.Add(Target{Id: "hook", Url: "http://localhost", Secret: "secret"}))
+	assert.NotNil(t, d.Add(Target{Id: "hook", Url: "http://localhost"}))
+
+	targets := d.Targets()
+	assert.Len(t, targets, 1)
+	assert.Empty(t, targets[0].Secret)
+
+	assert.True(t, d.Remove("hook"))
+	assert.False(t, d.Remove("hook"))
+	_, ok := d.Stats("hook")
+	assert.False(t, ok)
+}